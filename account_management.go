@@ -1,8 +1,11 @@
 package nexproto
 
 import (
+	"crypto/subtle"
 	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	nex "github.com/ihatecompvir/nex-go"
 )
@@ -10,19 +13,208 @@ import (
 const (
 	// AccountManagementProtocolID is the protocol ID for the Account Management protocol
 	AccountManagementProtocolID = 0x19
+	CreateAccount               = 0x01
 	DeleteAccount               = 0x02
+	DisableAccount              = 0x03
+	ChangePassword              = 0x04
+	TestCapability              = 0x05
+	GetName                     = 0x06
+	GetAccountData              = 0x07
+	GetPrivateData              = 0x08
+	GetPublicData               = 0x09
+	GetMultiplePublicData       = 0x0A
+	UpdateAccountName           = 0x0B
+	UpdateAccountEmail          = 0x0C
+	UpdateCustomData            = 0x0D
+	FindByNameRegex             = 0x0E
+	UpdateAccountExpiryDate     = 0x0F
+	UpdateAccountEffectiveDate  = 0x10
 	SetStatus                   = 0x11
+	GetStatus                   = 0x12
+	GetLastConnectionStats      = 0x13
+	ResetPassword               = 0x14
+	CreateAccountWithCustomData = 0x15
+	RetrieveAccount             = 0x16
+	UpdateAccount               = 0x17
+	ChangePasswordByGuest       = 0x18
 	FindByNameLike              = 0x19
+	CustomCreateAccount         = 0x1A
 	LookupOrCreateAccount       = 0x1B // also used by Xbox 360 when multiple profiles are signed in
+	DisconnectPrincipal         = 0x1C
+	DisconnectAllPrincipals     = 0x1D
 )
 
+// DefaultFindByNameLikeMaxResults is the default maximum number of FindByNameLike results
+const DefaultFindByNameLikeMaxResults = 100
+
 // AccountManagementProtocol handles the Account Management nex protocol
 type AccountManagementProtocol struct {
-	server                       *nex.Server
-	DeleteAccountHandler         func(err error, client *nex.Client, callID uint32, pid uint32)
-	LookupOrCreateAccountHandler func(err error, client *nex.Client, callID uint32, username string, key string, groups uint32, email string)
-	SetStatusHandler             func(err error, client *nex.Client, callID uint32, status string)
-	FindByNameLikeHandler        func(err error, client *nex.Client, callID uint32, uiGroups uint32, name string)
+	server                             *nex.Server
+	DeleteAccountHandler               func(err error, client *nex.Client, callID uint32, pid uint32)
+	LookupOrCreateAccountHandler       func(err error, client *nex.Client, callID uint32, username string, key string, groups uint32, email string, xboxUserInfo *XboxUserInfo, nintendoToken *NintendoToken)
+	SetStatusHandler                   func(err error, client *nex.Client, callID uint32, status string, presence *Presence)
+	FindByNameLikeHandler              func(err error, client *nex.Client, callID uint32, uiGroups uint32, pattern *NameLikePattern, resultRange *ResultRange)
+	CreateAccountHandler               func(err error, client *nex.Client, callID uint32, principalName string, key string, groups uint32, email string)
+	DisableAccountHandler              func(err error, client *nex.Client, callID uint32, pid uint32, until *nex.DateTime, message string)
+	ChangePasswordHandler              func(err error, client *nex.Client, callID uint32, newKey string)
+	TestCapabilityHandler              func(err error, client *nex.Client, callID uint32, capability uint32)
+	GetNameHandler                     func(err error, client *nex.Client, callID uint32, pid uint32)
+	GetAccountDataHandler              func(err error, client *nex.Client, callID uint32)
+	GetPrivateDataHandler              func(err error, client *nex.Client, callID uint32)
+	GetPublicDataHandler               func(err error, client *nex.Client, callID uint32, pid uint32)
+	GetMultiplePublicDataHandler       func(err error, client *nex.Client, callID uint32, pids []uint32)
+	UpdateAccountNameHandler           func(err error, client *nex.Client, callID uint32, name string)
+	UpdateAccountEmailHandler          func(err error, client *nex.Client, callID uint32, email string)
+	UpdateCustomDataHandler            func(err error, client *nex.Client, callID uint32, publicData *DataHolder, privateData *DataHolder)
+	FindByNameRegexHandler             func(err error, client *nex.Client, callID uint32, groups uint32, regex string, resultRange *ResultRange)
+	UpdateAccountExpiryDateHandler     func(err error, client *nex.Client, callID uint32, pid uint32, expiry *nex.DateTime, expiredMessage string)
+	UpdateAccountEffectiveDateHandler  func(err error, client *nex.Client, callID uint32, pid uint32, effectiveFrom *nex.DateTime, notEffectiveMessage string)
+	GetStatusHandler                   func(err error, client *nex.Client, callID uint32, pid uint32)
+	GetLastConnectionStatsHandler      func(err error, client *nex.Client, callID uint32, pid uint32)
+	ResetPasswordHandler               func(err error, client *nex.Client, callID uint32)
+	CreateAccountWithCustomDataHandler func(err error, client *nex.Client, callID uint32, principalName string, key string, groups uint32, email string, publicData *DataHolder, privateData *DataHolder)
+	RetrieveAccountHandler             func(err error, client *nex.Client, callID uint32)
+	UpdateAccountHandler               func(err error, client *nex.Client, callID uint32, key string, email string, publicData *DataHolder, privateData *DataHolder)
+	ChangePasswordByGuestHandler       func(err error, client *nex.Client, callID uint32, principalName string, key string, email string)
+	CustomCreateAccountHandler         func(err error, client *nex.Client, callID uint32, principalName string, key string, groups uint32, email string, authData *DataHolder)
+	DisconnectPrincipalHandler         func(err error, client *nex.Client, callID uint32, pid uint32)
+	DisconnectAllPrincipalsHandler     func(err error, client *nex.Client, callID uint32)
+
+	// AccountStore, when set, answers DeleteAccount, SetStatus, FindByNameLike and LookupOrCreateAccount
+	// for which no handler has been set
+	AccountStore AccountStore
+
+	// Authenticator, when set, gets every account created by the default LookupOrCreateAccount so it can log in
+	Authenticator AccountAuthenticator
+
+	// CanDeleteAccount, when set, decides if a client may delete an account other than its own with the default DeleteAccount
+	CanDeleteAccount func(client *nex.Client, pid uint32) bool
+
+	// PresenceStore, when set, records the presence of every logged in player who calls SetStatus
+	PresenceStore PresenceStore
+
+	// PresenceParser, when set, replaces ParsePresence for decoding SetStatus status strings
+	PresenceParser func(status string) *Presence
+
+	// FindByNameLikeMaxResults caps the size of the result range given to FindByNameLike, 0 for DefaultFindByNameLikeMaxResults
+	FindByNameLikeMaxResults uint32
+}
+
+// XboxUserInfo holds information about a signed-in Xbox 360 profile
+type XboxUserInfo struct {
+	XUID      uint64
+	Gamertag  string
+	MachineID uint64
+
+	hierarchy []nex.StructureInterface
+	*nex.NullData
+}
+
+// GetHierarchy returns the Structure hierarchy
+func (xboxUserInfo *XboxUserInfo) GetHierarchy() []nex.StructureInterface {
+	return xboxUserInfo.hierarchy
+}
+
+// ExtractFromStream extracts a XboxUserInfo structure from a stream
+func (xboxUserInfo *XboxUserInfo) ExtractFromStream(stream *nex.StreamIn) error {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 8 {
+		return errors.New("[XboxUserInfo::ExtractFromStream] Data missing XUID")
+	}
+
+	xuid := stream.ReadUInt64LE()
+
+	gamertag, err := stream.Read4ByteString()
+
+	if err != nil {
+		return err
+	}
+
+	if len(stream.Bytes()[stream.ByteOffset():]) < 8 {
+		return errors.New("[XboxUserInfo::ExtractFromStream] Data missing machine ID")
+	}
+
+	xboxUserInfo.XUID = xuid
+	xboxUserInfo.Gamertag = gamertag
+	xboxUserInfo.MachineID = stream.ReadUInt64LE()
+
+	return nil
+}
+
+// NewXboxUserInfo returns a new XboxUserInfo
+func NewXboxUserInfo() *XboxUserInfo {
+	xboxUserInfo := &XboxUserInfo{}
+
+	nullData := nex.NewNullData()
+
+	xboxUserInfo.NullData = nullData
+
+	xboxUserInfo.hierarchy = []nex.StructureInterface{
+		nullData,
+	}
+
+	return xboxUserInfo
+}
+
+// NintendoToken holds the console and profile information sent by a Wii
+type NintendoToken struct {
+	FriendCode  string
+	ProfileName string
+	Token       []byte
+
+	hierarchy []nex.StructureInterface
+	*nex.NullData
+}
+
+// GetHierarchy returns the Structure hierarchy
+func (nintendoToken *NintendoToken) GetHierarchy() []nex.StructureInterface {
+	return nintendoToken.hierarchy
+}
+
+// ExtractFromStream extracts a NintendoToken structure from a stream
+func (nintendoToken *NintendoToken) ExtractFromStream(stream *nex.StreamIn) error {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 7 {
+		return errors.New("[NintendoToken::ExtractFromStream] Data missing friend code")
+	}
+
+	// same encoding as the friend code sent to NintendoManagementProtocol::GetConsoleUsernames
+	friendCode := readFriendCode(stream)
+
+	if !isValidFriendCode(friendCode) {
+		return errors.New("[NintendoToken::ExtractFromStream] Friend code is not valid")
+	}
+
+	profileName, err := stream.Read4ByteString()
+
+	if err != nil {
+		return err
+	}
+
+	token, err := stream.ReadBuffer()
+
+	if err != nil {
+		return err
+	}
+
+	nintendoToken.FriendCode = fmt.Sprintf("%d", friendCode)
+	nintendoToken.ProfileName = profileName
+	nintendoToken.Token = token
+
+	return nil
+}
+
+// NewNintendoToken returns a new NintendoToken
+func NewNintendoToken() *NintendoToken {
+	nintendoToken := &NintendoToken{}
+
+	nullData := nex.NewNullData()
+
+	nintendoToken.NullData = nullData
+
+	nintendoToken.hierarchy = []nex.StructureInterface{
+		nullData,
+	}
+
+	return nintendoToken
 }
 
 // Setup initializes the protocol
@@ -42,11 +234,82 @@ func (accountManagementProtocol *AccountManagementProtocol) Setup() {
 				go accountManagementProtocol.handleSetStatus(packet)
 			case FindByNameLike:
 				go accountManagementProtocol.handleFindByNameLike(packet)
+			case CreateAccount:
+				go accountManagementProtocol.handleCreateAccount(packet)
+			case DisableAccount:
+				go accountManagementProtocol.handleDisableAccount(packet)
+			case ChangePassword:
+				go accountManagementProtocol.handleChangePassword(packet)
+			case TestCapability:
+				go accountManagementProtocol.handleTestCapability(packet)
+			case GetName:
+				go accountManagementProtocol.handleGetName(packet)
+			case GetAccountData:
+				go accountManagementProtocol.handleGetAccountData(packet)
+			case GetPrivateData:
+				go accountManagementProtocol.handleGetPrivateData(packet)
+			case GetPublicData:
+				go accountManagementProtocol.handleGetPublicData(packet)
+			case GetMultiplePublicData:
+				go accountManagementProtocol.handleGetMultiplePublicData(packet)
+			case UpdateAccountName:
+				go accountManagementProtocol.handleUpdateAccountName(packet)
+			case UpdateAccountEmail:
+				go accountManagementProtocol.handleUpdateAccountEmail(packet)
+			case UpdateCustomData:
+				go accountManagementProtocol.handleUpdateCustomData(packet)
+			case FindByNameRegex:
+				go accountManagementProtocol.handleFindByNameRegex(packet)
+			case UpdateAccountExpiryDate:
+				go accountManagementProtocol.handleUpdateAccountExpiryDate(packet)
+			case UpdateAccountEffectiveDate:
+				go accountManagementProtocol.handleUpdateAccountEffectiveDate(packet)
+			case GetStatus:
+				go accountManagementProtocol.handleGetStatus(packet)
+			case GetLastConnectionStats:
+				go accountManagementProtocol.handleGetLastConnectionStats(packet)
+			case ResetPassword:
+				go accountManagementProtocol.handleResetPassword(packet)
+			case CreateAccountWithCustomData:
+				go accountManagementProtocol.handleCreateAccountWithCustomData(packet)
+			case RetrieveAccount:
+				go accountManagementProtocol.handleRetrieveAccount(packet)
+			case UpdateAccount:
+				go accountManagementProtocol.handleUpdateAccount(packet)
+			case ChangePasswordByGuest:
+				go accountManagementProtocol.handleChangePasswordByGuest(packet)
+			case CustomCreateAccount:
+				go accountManagementProtocol.handleCustomCreateAccount(packet)
+			case DisconnectPrincipal:
+				go accountManagementProtocol.handleDisconnectPrincipal(packet)
+			case DisconnectAllPrincipals:
+				go accountManagementProtocol.handleDisconnectAllPrincipals(packet)
 			default:
 				log.Printf("Unsupported AccountManagement method ID: %#v\n", request.MethodID())
 			}
 		}
 	})
+
+	// the server kicks clients which time out as well as those which disconnect
+	nexServer.On("Disconnect", func(packet nex.PacketInterface) {
+		accountManagementProtocol.removePresence(packet.Sender().PID())
+	})
+
+	nexServer.On("Kick", func(packet nex.PacketInterface) {
+		accountManagementProtocol.removePresence(packet.Sender().PID())
+	})
+}
+
+// removePresence forgets the presence of a player who left the server
+func (accountManagementProtocol *AccountManagementProtocol) removePresence(pid uint32) {
+	// clients which haven't logged in all share PID 0 and never have a presence
+	if accountManagementProtocol.PresenceStore == nil || pid == 0 {
+		return
+	}
+
+	if err := accountManagementProtocol.PresenceStore.RemovePresence(pid); err != nil {
+		log.Println(err)
+	}
 }
 
 // DeleteAccount sets the DeleteAccount handler function
@@ -54,23 +317,154 @@ func (accountManagementProtocol *AccountManagementProtocol) DeleteAccount(handle
 	accountManagementProtocol.DeleteAccountHandler = handler
 }
 
-// CreateAccount sets the CreateAccount handler function
-func (accountManagementProtocol *AccountManagementProtocol) LookupOrCreateAccount(handler func(err error, client *nex.Client, callID uint32, username string, key string, groups uint32, email string)) {
+// LookupOrCreateAccount sets the LookupOrCreateAccount handler function
+func (accountManagementProtocol *AccountManagementProtocol) LookupOrCreateAccount(handler func(err error, client *nex.Client, callID uint32, username string, key string, groups uint32, email string, xboxUserInfo *XboxUserInfo, nintendoToken *NintendoToken)) {
 	accountManagementProtocol.LookupOrCreateAccountHandler = handler
 }
 
 // SetStatus sets the SetStatus handler function
-func (accountManagementProtocol *AccountManagementProtocol) SetStatus(handler func(err error, client *nex.Client, callID uint32, status string)) {
+func (accountManagementProtocol *AccountManagementProtocol) SetStatus(handler func(err error, client *nex.Client, callID uint32, status string, presence *Presence)) {
 	accountManagementProtocol.SetStatusHandler = handler
 }
 
 // FindByNameLike sets the FindByNameLike handler function
-func (accountManagementProtocol *AccountManagementProtocol) FindByNameLike(handler func(err error, client *nex.Client, callID uint32, uiGroups uint32, name string)) {
+func (accountManagementProtocol *AccountManagementProtocol) FindByNameLike(handler func(err error, client *nex.Client, callID uint32, uiGroups uint32, pattern *NameLikePattern, resultRange *ResultRange)) {
 	accountManagementProtocol.FindByNameLikeHandler = handler
 }
 
+// CreateAccount sets the CreateAccount handler function
+func (accountManagementProtocol *AccountManagementProtocol) CreateAccount(handler func(err error, client *nex.Client, callID uint32, principalName string, key string, groups uint32, email string)) {
+	accountManagementProtocol.CreateAccountHandler = handler
+}
+
+// DisableAccount sets the DisableAccount handler function
+func (accountManagementProtocol *AccountManagementProtocol) DisableAccount(handler func(err error, client *nex.Client, callID uint32, pid uint32, until *nex.DateTime, message string)) {
+	accountManagementProtocol.DisableAccountHandler = handler
+}
+
+// ChangePassword sets the ChangePassword handler function
+func (accountManagementProtocol *AccountManagementProtocol) ChangePassword(handler func(err error, client *nex.Client, callID uint32, newKey string)) {
+	accountManagementProtocol.ChangePasswordHandler = handler
+}
+
+// TestCapability sets the TestCapability handler function
+func (accountManagementProtocol *AccountManagementProtocol) TestCapability(handler func(err error, client *nex.Client, callID uint32, capability uint32)) {
+	accountManagementProtocol.TestCapabilityHandler = handler
+}
+
+// GetName sets the GetName handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetName(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	accountManagementProtocol.GetNameHandler = handler
+}
+
+// GetAccountData sets the GetAccountData handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetAccountData(handler func(err error, client *nex.Client, callID uint32)) {
+	accountManagementProtocol.GetAccountDataHandler = handler
+}
+
+// GetPrivateData sets the GetPrivateData handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetPrivateData(handler func(err error, client *nex.Client, callID uint32)) {
+	accountManagementProtocol.GetPrivateDataHandler = handler
+}
+
+// GetPublicData sets the GetPublicData handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetPublicData(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	accountManagementProtocol.GetPublicDataHandler = handler
+}
+
+// GetMultiplePublicData sets the GetMultiplePublicData handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetMultiplePublicData(handler func(err error, client *nex.Client, callID uint32, pids []uint32)) {
+	accountManagementProtocol.GetMultiplePublicDataHandler = handler
+}
+
+// UpdateAccountName sets the UpdateAccountName handler function
+func (accountManagementProtocol *AccountManagementProtocol) UpdateAccountName(handler func(err error, client *nex.Client, callID uint32, name string)) {
+	accountManagementProtocol.UpdateAccountNameHandler = handler
+}
+
+// UpdateAccountEmail sets the UpdateAccountEmail handler function
+func (accountManagementProtocol *AccountManagementProtocol) UpdateAccountEmail(handler func(err error, client *nex.Client, callID uint32, email string)) {
+	accountManagementProtocol.UpdateAccountEmailHandler = handler
+}
+
+// UpdateCustomData sets the UpdateCustomData handler function
+func (accountManagementProtocol *AccountManagementProtocol) UpdateCustomData(handler func(err error, client *nex.Client, callID uint32, publicData *DataHolder, privateData *DataHolder)) {
+	accountManagementProtocol.UpdateCustomDataHandler = handler
+}
+
+// FindByNameRegex sets the FindByNameRegex handler function
+func (accountManagementProtocol *AccountManagementProtocol) FindByNameRegex(handler func(err error, client *nex.Client, callID uint32, groups uint32, regex string, resultRange *ResultRange)) {
+	accountManagementProtocol.FindByNameRegexHandler = handler
+}
+
+// UpdateAccountExpiryDate sets the UpdateAccountExpiryDate handler function
+func (accountManagementProtocol *AccountManagementProtocol) UpdateAccountExpiryDate(handler func(err error, client *nex.Client, callID uint32, pid uint32, expiry *nex.DateTime, expiredMessage string)) {
+	accountManagementProtocol.UpdateAccountExpiryDateHandler = handler
+}
+
+// UpdateAccountEffectiveDate sets the UpdateAccountEffectiveDate handler function
+func (accountManagementProtocol *AccountManagementProtocol) UpdateAccountEffectiveDate(handler func(err error, client *nex.Client, callID uint32, pid uint32, effectiveFrom *nex.DateTime, notEffectiveMessage string)) {
+	accountManagementProtocol.UpdateAccountEffectiveDateHandler = handler
+}
+
+// GetStatus sets the GetStatus handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetStatus(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	accountManagementProtocol.GetStatusHandler = handler
+}
+
+// GetLastConnectionStats sets the GetLastConnectionStats handler function
+func (accountManagementProtocol *AccountManagementProtocol) GetLastConnectionStats(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	accountManagementProtocol.GetLastConnectionStatsHandler = handler
+}
+
+// ResetPassword sets the ResetPassword handler function
+func (accountManagementProtocol *AccountManagementProtocol) ResetPassword(handler func(err error, client *nex.Client, callID uint32)) {
+	accountManagementProtocol.ResetPasswordHandler = handler
+}
+
+// CreateAccountWithCustomData sets the CreateAccountWithCustomData handler function
+func (accountManagementProtocol *AccountManagementProtocol) CreateAccountWithCustomData(handler func(err error, client *nex.Client, callID uint32, principalName string, key string, groups uint32, email string, publicData *DataHolder, privateData *DataHolder)) {
+	accountManagementProtocol.CreateAccountWithCustomDataHandler = handler
+}
+
+// RetrieveAccount sets the RetrieveAccount handler function
+func (accountManagementProtocol *AccountManagementProtocol) RetrieveAccount(handler func(err error, client *nex.Client, callID uint32)) {
+	accountManagementProtocol.RetrieveAccountHandler = handler
+}
+
+// UpdateAccount sets the UpdateAccount handler function
+func (accountManagementProtocol *AccountManagementProtocol) UpdateAccount(handler func(err error, client *nex.Client, callID uint32, key string, email string, publicData *DataHolder, privateData *DataHolder)) {
+	accountManagementProtocol.UpdateAccountHandler = handler
+}
+
+// ChangePasswordByGuest sets the ChangePasswordByGuest handler function
+func (accountManagementProtocol *AccountManagementProtocol) ChangePasswordByGuest(handler func(err error, client *nex.Client, callID uint32, principalName string, key string, email string)) {
+	accountManagementProtocol.ChangePasswordByGuestHandler = handler
+}
+
+// CustomCreateAccount sets the CustomCreateAccount handler function
+func (accountManagementProtocol *AccountManagementProtocol) CustomCreateAccount(handler func(err error, client *nex.Client, callID uint32, principalName string, key string, groups uint32, email string, authData *DataHolder)) {
+	accountManagementProtocol.CustomCreateAccountHandler = handler
+}
+
+// DisconnectPrincipal sets the DisconnectPrincipal handler function
+func (accountManagementProtocol *AccountManagementProtocol) DisconnectPrincipal(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	accountManagementProtocol.DisconnectPrincipalHandler = handler
+}
+
+// DisconnectAllPrincipals sets the DisconnectAllPrincipals handler function
+func (accountManagementProtocol *AccountManagementProtocol) DisconnectAllPrincipals(handler func(err error, client *nex.Client, callID uint32)) {
+	accountManagementProtocol.DisconnectAllPrincipalsHandler = handler
+}
+
 func (accountManagementProtocol *AccountManagementProtocol) handleDeleteAccount(packet nex.PacketInterface) {
-	if accountManagementProtocol.DeleteAccountHandler == nil {
+	handler := accountManagementProtocol.DeleteAccountHandler
+
+	if handler == nil && accountManagementProtocol.AccountStore != nil {
+		handler = accountManagementProtocol.defaultDeleteAccount
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AccountManagementProtocol::DeleteAccount not implemented")
 		go respondNotImplemented(packet, AccountManagementProtocolID)
 		return
@@ -86,11 +480,17 @@ func (accountManagementProtocol *AccountManagementProtocol) handleDeleteAccount(
 
 	pid := parametersStream.ReadUInt32LE()
 
-	go accountManagementProtocol.DeleteAccountHandler(nil, client, callID, pid)
+	go handler(nil, client, callID, pid)
 }
 
 func (accountManagementProtocol *AccountManagementProtocol) handleLookupOrCreateAccount(packet nex.PacketInterface) {
-	if accountManagementProtocol.LookupOrCreateAccountHandler == nil {
+	handler := accountManagementProtocol.LookupOrCreateAccountHandler
+
+	if handler == nil && accountManagementProtocol.AccountStore != nil {
+		handler = accountManagementProtocol.defaultLookupOrCreateAccount
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AccountManagementProtocol::LookupOrCreateAccount not implemented")
 		go respondNotImplemented(packet, AccountManagementProtocolID)
 		return
@@ -102,45 +502,82 @@ func (accountManagementProtocol *AccountManagementProtocol) handleLookupOrCreate
 	callID := request.CallID()
 	parameters := request.Parameters()
 
-	parametersStream := nex.NewStreamIn(parameters, accountManagementProtocol.server)
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
 
 	username, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go accountManagementProtocol.LookupOrCreateAccountHandler(err, client, callID, "", "", 0, "")
+		go handler(err, client, callID, "", "", 0, "", nil, nil)
 		return
 	}
 
 	key, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go accountManagementProtocol.LookupOrCreateAccountHandler(err, client, callID, "", "", 0, "")
+		go handler(err, client, callID, "", "", 0, "", nil, nil)
 		return
 	}
 
 	groups := parametersStream.ReadUInt32LE()
 	email, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go accountManagementProtocol.LookupOrCreateAccountHandler(err, client, callID, "", "", 0, "")
+		go handler(err, client, callID, "", "", 0, "", nil, nil)
 		return
 	}
 
-	dataHolderName, err := parametersStream.Read4ByteString()
+	dataHolder, err := parametersStream.ReadDataHolder()
 	if err != nil {
-		go accountManagementProtocol.LookupOrCreateAccountHandler(err, client, callID, "", "", 0, "")
+		go handler(err, client, callID, "", "", 0, "", nil, nil)
 		return
 	}
 
+	dataHolderName := dataHolder.Name
+
 	// I don't think PS3 can ever call this method, but just in case
 	if dataHolderName != "NintendoToken" && dataHolderName != "XboxUserInfo" && dataHolderName != "SonyNPTicket" {
 		err := errors.New("[AccountManagementProtocol::LookupOrCreateAccount] Data holder name does not match")
-		go accountManagementProtocol.LookupOrCreateAccountHandler(err, client, callID, "", "", 0, "")
+		go handler(err, client, callID, "", "", 0, "", nil, nil)
 		return
 	}
 
-	go accountManagementProtocol.LookupOrCreateAccountHandler(nil, client, callID, username, key, groups, email)
+	var xboxUserInfo *XboxUserInfo
+
+	// Xbox 360 calls this once for every signed-in profile, each with its own XboxUserInfo
+	if dataHolderName == "XboxUserInfo" {
+		dataHolderContentStream := nex.NewStreamIn(dataHolder.Data, accountManagementProtocol.server)
+
+		xboxUserInfoStructure, err := dataHolderContentStream.ReadStructure(NewXboxUserInfo())
+		if err != nil {
+			go handler(err, client, callID, "", "", 0, "", nil, nil)
+			return
+		}
+
+		xboxUserInfo = xboxUserInfoStructure.(*XboxUserInfo)
+	}
+
+	var nintendoToken *NintendoToken
+
+	if dataHolderName == "NintendoToken" {
+		dataHolderContentStream := nex.NewStreamIn(dataHolder.Data, accountManagementProtocol.server)
+
+		nintendoTokenStructure, err := dataHolderContentStream.ReadStructure(NewNintendoToken())
+		if err != nil {
+			go handler(err, client, callID, "", "", 0, "", nil, nil)
+			return
+		}
+
+		nintendoToken = nintendoTokenStructure.(*NintendoToken)
+	}
+
+	go handler(nil, client, callID, username, key, groups, email, xboxUserInfo, nintendoToken)
 }
 
 func (accountManagementProtocol *AccountManagementProtocol) handleSetStatus(packet nex.PacketInterface) {
-	if accountManagementProtocol.SetStatusHandler == nil {
+	handler := accountManagementProtocol.SetStatusHandler
+
+	if handler == nil && (accountManagementProtocol.AccountStore != nil || accountManagementProtocol.PresenceStore != nil) {
+		handler = accountManagementProtocol.defaultSetStatus
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AccountManagementProtocol::SetStatus not implemented")
 		go respondNotImplemented(packet, AccountManagementProtocolID)
 		return
@@ -156,15 +593,43 @@ func (accountManagementProtocol *AccountManagementProtocol) handleSetStatus(pack
 
 	status, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go accountManagementProtocol.SetStatusHandler(err, client, callID, "")
+		go handler(err, client, callID, "", nil)
 		return
 	}
 
-	go accountManagementProtocol.SetStatusHandler(nil, client, callID, status)
+	parsePresence := accountManagementProtocol.PresenceParser
+
+	if parsePresence == nil {
+		parsePresence = ParsePresence
+	}
+
+	presence := parsePresence(status)
+
+	if presence == nil {
+		presence = &Presence{Raw: status}
+	}
+
+	presence.PID = client.PID()
+	presence.UpdatedAt = time.Now()
+
+	// clients which haven't logged in all share PID 0
+	if accountManagementProtocol.PresenceStore != nil && presence.PID != 0 {
+		if err := accountManagementProtocol.PresenceStore.SetPresence(presence); err != nil {
+			log.Println(err)
+		}
+	}
+
+	go handler(nil, client, callID, status, presence)
 }
 
 func (accountManagementProtocol *AccountManagementProtocol) handleFindByNameLike(packet nex.PacketInterface) {
-	if accountManagementProtocol.FindByNameLikeHandler == nil {
+	handler := accountManagementProtocol.FindByNameLikeHandler
+
+	if handler == nil && accountManagementProtocol.AccountStore != nil {
+		handler = accountManagementProtocol.defaultFindByNameLike
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AccountManagementProtocol::FindByNameLike not implemented")
 		go respondNotImplemented(packet, AccountManagementProtocolID)
 		return
@@ -176,21 +641,1004 @@ func (accountManagementProtocol *AccountManagementProtocol) handleFindByNameLike
 	callID := request.CallID()
 	parameters := request.Parameters()
 
-	parametersStream := nex.NewStreamIn(parameters, accountManagementProtocol.server)
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::FindByNameLike] Data missing groups")
+		go handler(err, client, callID, 0, nil, nil)
+		return
+	}
 
 	uiGroups := parametersStream.ReadUInt32LE()
 	name, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go accountManagementProtocol.FindByNameLikeHandler(err, client, callID, 0, "")
+		go handler(err, client, callID, 0, nil, nil)
+		return
+	}
+
+	pattern, err := ParseNameLikePattern(name)
+	if err != nil {
+		go handler(err, client, callID, 0, nil, nil)
 		return
 	}
 
-	go accountManagementProtocol.FindByNameLikeHandler(nil, client, callID, uiGroups, name)
+	maxResults := accountManagementProtocol.FindByNameLikeMaxResults
+
+	if maxResults == 0 {
+		maxResults = DefaultFindByNameLikeMaxResults
+	}
+
+	resultRange := &ResultRange{Offset: 0, Size: maxResults}
+
+	// Older clients don't send a result range
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) >= 8 {
+		resultRange, err = parametersStream.ReadResultRange()
+		if err != nil {
+			go handler(err, client, callID, 0, nil, nil)
+			return
+		}
+	}
+
+	if resultRange.Size > maxResults {
+		resultRange.Size = maxResults
+	}
+
+	go handler(nil, client, callID, uiGroups, pattern, resultRange)
 }
 
-// NewAccountManagementProtocol returns a new AccountManagementProtocol
-func NewAccountManagementProtocol(server *nex.Server) *AccountManagementProtocol {
-	accountManagementProtocol := &AccountManagementProtocol{server: server}
+func (accountManagementProtocol *AccountManagementProtocol) handleCreateAccount(packet nex.PacketInterface) {
+	if accountManagementProtocol.CreateAccountHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::CreateAccount not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	principalName, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountHandler(err, client, callID, "", "", 0, "")
+		return
+	}
+
+	key, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountHandler(err, client, callID, "", "", 0, "")
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::CreateAccount] Data missing groups")
+		go accountManagementProtocol.CreateAccountHandler(err, client, callID, "", "", 0, "")
+		return
+	}
+
+	groups := parametersStream.ReadUInt32LE()
+
+	email, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountHandler(err, client, callID, "", "", 0, "")
+		return
+	}
+
+	go accountManagementProtocol.CreateAccountHandler(nil, client, callID, principalName, key, groups, email)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleDisableAccount(packet nex.PacketInterface) {
+	if accountManagementProtocol.DisableAccountHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::DisableAccount not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::DisableAccount] Data missing PID")
+		go accountManagementProtocol.DisableAccountHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 8 {
+		err := errors.New("[AccountManagementProtocol::DisableAccount] Data missing date")
+		go accountManagementProtocol.DisableAccountHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	until := nex.NewDateTime(parametersStream.ReadUInt64LE())
+
+	message, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.DisableAccountHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	go accountManagementProtocol.DisableAccountHandler(nil, client, callID, pid, until, message)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleChangePassword(packet nex.PacketInterface) {
+	if accountManagementProtocol.ChangePasswordHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::ChangePassword not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	newKey, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.ChangePasswordHandler(err, client, callID, "")
+		return
+	}
+
+	go accountManagementProtocol.ChangePasswordHandler(nil, client, callID, newKey)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleTestCapability(packet nex.PacketInterface) {
+	if accountManagementProtocol.TestCapabilityHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::TestCapability not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::TestCapability] Data missing capability")
+		go accountManagementProtocol.TestCapabilityHandler(err, client, callID, 0)
+		return
+	}
+
+	capability := parametersStream.ReadUInt32LE()
+
+	go accountManagementProtocol.TestCapabilityHandler(nil, client, callID, capability)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetName(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetNameHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetName not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::GetName] Data missing PID")
+		go accountManagementProtocol.GetNameHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go accountManagementProtocol.GetNameHandler(nil, client, callID, pid)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetAccountData(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetAccountDataHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetAccountData not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+
+	go accountManagementProtocol.GetAccountDataHandler(nil, client, callID)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetPrivateData(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetPrivateDataHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetPrivateData not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+
+	go accountManagementProtocol.GetPrivateDataHandler(nil, client, callID)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetPublicData(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetPublicDataHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetPublicData not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::GetPublicData] Data missing PID")
+		go accountManagementProtocol.GetPublicDataHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go accountManagementProtocol.GetPublicDataHandler(nil, client, callID, pid)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetMultiplePublicData(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetMultiplePublicDataHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetMultiplePublicData not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	pids, err := parametersStream.ReadListUInt32LE()
+	if err != nil {
+		go accountManagementProtocol.GetMultiplePublicDataHandler(err, client, callID, nil)
+		return
+	}
+
+	go accountManagementProtocol.GetMultiplePublicDataHandler(nil, client, callID, pids)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleUpdateAccountName(packet nex.PacketInterface) {
+	if accountManagementProtocol.UpdateAccountNameHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::UpdateAccountName not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	name, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountNameHandler(err, client, callID, "")
+		return
+	}
+
+	go accountManagementProtocol.UpdateAccountNameHandler(nil, client, callID, name)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleUpdateAccountEmail(packet nex.PacketInterface) {
+	if accountManagementProtocol.UpdateAccountEmailHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::UpdateAccountEmail not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	email, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountEmailHandler(err, client, callID, "")
+		return
+	}
+
+	go accountManagementProtocol.UpdateAccountEmailHandler(nil, client, callID, email)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleUpdateCustomData(packet nex.PacketInterface) {
+	if accountManagementProtocol.UpdateCustomDataHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::UpdateCustomData not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	publicData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.UpdateCustomDataHandler(err, client, callID, nil, nil)
+		return
+	}
+
+	privateData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.UpdateCustomDataHandler(err, client, callID, nil, nil)
+		return
+	}
+
+	go accountManagementProtocol.UpdateCustomDataHandler(nil, client, callID, publicData, privateData)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleFindByNameRegex(packet nex.PacketInterface) {
+	if accountManagementProtocol.FindByNameRegexHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::FindByNameRegex not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::FindByNameRegex] Data missing groups")
+		go accountManagementProtocol.FindByNameRegexHandler(err, client, callID, 0, "", nil)
+		return
+	}
+
+	groups := parametersStream.ReadUInt32LE()
+
+	regex, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.FindByNameRegexHandler(err, client, callID, 0, "", nil)
+		return
+	}
+
+	resultRange, err := parametersStream.ReadResultRange()
+	if err != nil {
+		go accountManagementProtocol.FindByNameRegexHandler(err, client, callID, 0, "", nil)
+		return
+	}
+
+	go accountManagementProtocol.FindByNameRegexHandler(nil, client, callID, groups, regex, resultRange)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleUpdateAccountExpiryDate(packet nex.PacketInterface) {
+	if accountManagementProtocol.UpdateAccountExpiryDateHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::UpdateAccountExpiryDate not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::UpdateAccountExpiryDate] Data missing PID")
+		go accountManagementProtocol.UpdateAccountExpiryDateHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 8 {
+		err := errors.New("[AccountManagementProtocol::UpdateAccountExpiryDate] Data missing date")
+		go accountManagementProtocol.UpdateAccountExpiryDateHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	expiry := nex.NewDateTime(parametersStream.ReadUInt64LE())
+
+	expiredMessage, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountExpiryDateHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	go accountManagementProtocol.UpdateAccountExpiryDateHandler(nil, client, callID, pid, expiry, expiredMessage)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleUpdateAccountEffectiveDate(packet nex.PacketInterface) {
+	if accountManagementProtocol.UpdateAccountEffectiveDateHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::UpdateAccountEffectiveDate not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::UpdateAccountEffectiveDate] Data missing PID")
+		go accountManagementProtocol.UpdateAccountEffectiveDateHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 8 {
+		err := errors.New("[AccountManagementProtocol::UpdateAccountEffectiveDate] Data missing date")
+		go accountManagementProtocol.UpdateAccountEffectiveDateHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	effectiveFrom := nex.NewDateTime(parametersStream.ReadUInt64LE())
+
+	notEffectiveMessage, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountEffectiveDateHandler(err, client, callID, 0, nil, "")
+		return
+	}
+
+	go accountManagementProtocol.UpdateAccountEffectiveDateHandler(nil, client, callID, pid, effectiveFrom, notEffectiveMessage)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetStatus(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetStatusHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetStatus not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::GetStatus] Data missing PID")
+		go accountManagementProtocol.GetStatusHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go accountManagementProtocol.GetStatusHandler(nil, client, callID, pid)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleGetLastConnectionStats(packet nex.PacketInterface) {
+	if accountManagementProtocol.GetLastConnectionStatsHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::GetLastConnectionStats not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::GetLastConnectionStats] Data missing PID")
+		go accountManagementProtocol.GetLastConnectionStatsHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go accountManagementProtocol.GetLastConnectionStatsHandler(nil, client, callID, pid)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleResetPassword(packet nex.PacketInterface) {
+	if accountManagementProtocol.ResetPasswordHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::ResetPassword not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+
+	go accountManagementProtocol.ResetPasswordHandler(nil, client, callID)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleCreateAccountWithCustomData(packet nex.PacketInterface) {
+	if accountManagementProtocol.CreateAccountWithCustomDataHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::CreateAccountWithCustomData not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	principalName, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountWithCustomDataHandler(err, client, callID, "", "", 0, "", nil, nil)
+		return
+	}
+
+	key, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountWithCustomDataHandler(err, client, callID, "", "", 0, "", nil, nil)
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::CreateAccountWithCustomData] Data missing groups")
+		go accountManagementProtocol.CreateAccountWithCustomDataHandler(err, client, callID, "", "", 0, "", nil, nil)
+		return
+	}
+
+	groups := parametersStream.ReadUInt32LE()
+
+	email, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountWithCustomDataHandler(err, client, callID, "", "", 0, "", nil, nil)
+		return
+	}
+
+	publicData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountWithCustomDataHandler(err, client, callID, "", "", 0, "", nil, nil)
+		return
+	}
+
+	privateData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.CreateAccountWithCustomDataHandler(err, client, callID, "", "", 0, "", nil, nil)
+		return
+	}
+
+	go accountManagementProtocol.CreateAccountWithCustomDataHandler(nil, client, callID, principalName, key, groups, email, publicData, privateData)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleRetrieveAccount(packet nex.PacketInterface) {
+	if accountManagementProtocol.RetrieveAccountHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::RetrieveAccount not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+
+	go accountManagementProtocol.RetrieveAccountHandler(nil, client, callID)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleUpdateAccount(packet nex.PacketInterface) {
+	if accountManagementProtocol.UpdateAccountHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::UpdateAccount not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	key, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountHandler(err, client, callID, "", "", nil, nil)
+		return
+	}
+
+	email, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountHandler(err, client, callID, "", "", nil, nil)
+		return
+	}
+
+	publicData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountHandler(err, client, callID, "", "", nil, nil)
+		return
+	}
+
+	privateData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.UpdateAccountHandler(err, client, callID, "", "", nil, nil)
+		return
+	}
+
+	go accountManagementProtocol.UpdateAccountHandler(nil, client, callID, key, email, publicData, privateData)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleChangePasswordByGuest(packet nex.PacketInterface) {
+	if accountManagementProtocol.ChangePasswordByGuestHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::ChangePasswordByGuest not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	principalName, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.ChangePasswordByGuestHandler(err, client, callID, "", "", "")
+		return
+	}
+
+	key, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.ChangePasswordByGuestHandler(err, client, callID, "", "", "")
+		return
+	}
+
+	email, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.ChangePasswordByGuestHandler(err, client, callID, "", "", "")
+		return
+	}
+
+	go accountManagementProtocol.ChangePasswordByGuestHandler(nil, client, callID, principalName, key, email)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleCustomCreateAccount(packet nex.PacketInterface) {
+	if accountManagementProtocol.CustomCreateAccountHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::CustomCreateAccount not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	principalName, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CustomCreateAccountHandler(err, client, callID, "", "", 0, "", nil)
+		return
+	}
+
+	key, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CustomCreateAccountHandler(err, client, callID, "", "", 0, "", nil)
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::CustomCreateAccount] Data missing groups")
+		go accountManagementProtocol.CustomCreateAccountHandler(err, client, callID, "", "", 0, "", nil)
+		return
+	}
+
+	groups := parametersStream.ReadUInt32LE()
+
+	email, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go accountManagementProtocol.CustomCreateAccountHandler(err, client, callID, "", "", 0, "", nil)
+		return
+	}
+
+	authData, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go accountManagementProtocol.CustomCreateAccountHandler(err, client, callID, "", "", 0, "", nil)
+		return
+	}
+
+	go accountManagementProtocol.CustomCreateAccountHandler(nil, client, callID, principalName, key, groups, email, authData)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleDisconnectPrincipal(packet nex.PacketInterface) {
+	if accountManagementProtocol.DisconnectPrincipalHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::DisconnectPrincipal not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, accountManagementProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[AccountManagementProtocol::DisconnectPrincipal] Data missing PID")
+		go accountManagementProtocol.DisconnectPrincipalHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go accountManagementProtocol.DisconnectPrincipalHandler(nil, client, callID, pid)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) handleDisconnectAllPrincipals(packet nex.PacketInterface) {
+	if accountManagementProtocol.DisconnectAllPrincipalsHandler == nil {
+		log.Println("[Warning] AccountManagementProtocol::DisconnectAllPrincipals not implemented")
+		go respondNotImplemented(packet, AccountManagementProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+
+	go accountManagementProtocol.DisconnectAllPrincipalsHandler(nil, client, callID)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) defaultDeleteAccount(err error, client *nex.Client, callID uint32, pid uint32) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if !accountManagementProtocol.canDeleteAccount(client, pid) {
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	if err := accountManagementProtocol.AccountStore.DeleteAccount(pid); err != nil {
+		accountManagementProtocol.respondAccountStoreError(client, callID, err)
+		return
+	}
+
+	respondSuccess(client, AccountManagementProtocolID, callID, DeleteAccount, nil)
+}
+
+// canDeleteAccount checks if a client may delete an account, which is only its own unless CanDeleteAccount allows more
+func (accountManagementProtocol *AccountManagementProtocol) canDeleteAccount(client *nex.Client, pid uint32) bool {
+	if client.PID() != 0 && pid == client.PID() {
+		return true
+	}
+
+	return accountManagementProtocol.CanDeleteAccount != nil && accountManagementProtocol.CanDeleteAccount(client, pid)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) defaultLookupOrCreateAccount(err error, client *nex.Client, callID uint32, username string, key string, groups uint32, email string, xboxUserInfo *XboxUserInfo, nintendoToken *NintendoToken) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	accountStore := accountManagementProtocol.AccountStore
+
+	var identity *PlatformIdentity
+
+	if xboxUserInfo != nil {
+		identity = &PlatformIdentity{Platform: "xbox", ID: fmt.Sprintf("%016X", xboxUserInfo.XUID)}
+	} else if nintendoToken != nil {
+		identity = &PlatformIdentity{Platform: "wii", ID: nintendoToken.FriendCode + "/" + nintendoToken.ProfileName}
+	}
+
+	var account *Account
+
+	if identity != nil {
+		account, err = accountStore.LookupAccountByPlatformIdentity(*identity)
+
+		if err != nil && !errors.Is(err, ErrAccountNotFound) {
+			accountManagementProtocol.respondAccountStoreError(client, callID, err)
+			return
+		}
+
+		// the platform identity comes from the client too, so it doesn't prove anything without the key
+		if account != nil && !accountKeyMatches(account, key) {
+			respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeRendezVousInvalidPassword)
+			return
+		}
+	}
+
+	if account == nil {
+		account, err = accountStore.LookupAccountByName(username)
+
+		if err == nil {
+			// an existing account is only handed out, and linked to the profile, if the key matches
+			if !accountKeyMatches(account, key) {
+				respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeRendezVousInvalidPassword)
+				return
+			}
+
+			if identity != nil {
+				err = accountStore.LinkPlatformIdentity(account.PID, *identity)
+			}
+		} else if errors.Is(err, ErrAccountNotFound) {
+			newAccount := &Account{
+				Name:   username,
+				Groups: groups,
+				Email:  email,
+			}
+
+			if identity != nil {
+				newAccount.PlatformIdentities = []PlatformIdentity{*identity}
+			}
+
+			account, err = accountManagementProtocol.createAccount(newAccount, key)
+		}
+
+		if err != nil {
+			accountManagementProtocol.respondAccountStoreError(client, callID, err)
+			return
+		}
+	}
+
+	rmcResponseStream := NewStreamOut(accountManagementProtocol.server)
+
+	rmcResponseStream.WriteUInt32LE(account.PID)
+
+	respondSuccess(client, AccountManagementProtocolID, callID, LookupOrCreateAccount, rmcResponseStream.Bytes())
+}
+
+// createAccount stores a new account with the Kerberos key derived from key, which needs the PID
+// the store assigns, and adds it to the Authenticator. The account is removed again if either step fails
+func (accountManagementProtocol *AccountManagementProtocol) createAccount(newAccount *Account, key string) (*Account, error) {
+	accountStore := accountManagementProtocol.AccountStore
+
+	account, err := accountStore.CreateAccount(newAccount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	account.KerberosKey = DeriveKerberosKey(account.PID, []byte(key))
+
+	err = accountStore.UpdateAccount(account)
+
+	if err == nil && accountManagementProtocol.Authenticator != nil {
+		err = accountManagementProtocol.Authenticator.AddAccountKey(account.PID, account.Name, account.KerberosKey)
+	}
+
+	if err != nil {
+		if deleteErr := accountStore.DeleteAccount(account.PID); deleteErr != nil {
+			log.Println(deleteErr)
+		}
+
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// accountKeyMatches checks in constant time that key derives the Kerberos key of an account
+func accountKeyMatches(account *Account, key string) bool {
+	return subtle.ConstantTimeCompare(DeriveKerberosKey(account.PID, []byte(key)), account.KerberosKey) == 1
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) defaultSetStatus(err error, client *nex.Client, callID uint32, status string, presence *Presence) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	// the presence has already been recorded, only the account is left to update
+	if accountManagementProtocol.AccountStore == nil {
+		respondSuccess(client, AccountManagementProtocolID, callID, SetStatus, nil)
+		return
+	}
+
+	account, err := accountManagementProtocol.AccountStore.LookupAccountByPID(client.PID())
+
+	if err == nil {
+		account.Status = status
+		err = accountManagementProtocol.AccountStore.UpdateAccount(account)
+	}
+
+	if err != nil {
+		accountManagementProtocol.respondAccountStoreError(client, callID, err)
+		return
+	}
+
+	respondSuccess(client, AccountManagementProtocolID, callID, SetStatus, nil)
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) defaultFindByNameLike(err error, client *nex.Client, callID uint32, uiGroups uint32, pattern *NameLikePattern, resultRange *ResultRange) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	accounts, err := accountManagementProtocol.AccountStore.FindAccountsByName(pattern, uiGroups, resultRange)
+
+	if err != nil {
+		accountManagementProtocol.respondAccountStoreError(client, callID, err)
+		return
+	}
+
+	rmcResponseStream := NewStreamOut(accountManagementProtocol.server)
+
+	// List<BasicAccountInfo>
+	rmcResponseStream.WriteUInt32LE(uint32(len(accounts)))
+	for _, account := range accounts {
+		rmcResponseStream.WriteUInt32LE(account.PID)
+		rmcResponseStream.Write4ByteString(account.Name)
+	}
+
+	respondSuccess(client, AccountManagementProtocolID, callID, FindByNameLike, rmcResponseStream.Bytes())
+}
+
+func (accountManagementProtocol *AccountManagementProtocol) respondAccountStoreError(client *nex.Client, callID uint32, err error) {
+	switch {
+	case errors.Is(err, ErrAccountNotFound):
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeRendezVousInvalidPID)
+	case errors.Is(err, ErrAccountExists):
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeRendezVousUsernameAlreadyExists)
+	default:
+		log.Println(err)
+		respondErrorCode(client, AccountManagementProtocolID, callID, ResultCodeCoreUnknown)
+	}
+}
+
+// NewAccountManagementProtocol returns a new AccountManagementProtocol
+func NewAccountManagementProtocol(server *nex.Server) *AccountManagementProtocol {
+	accountManagementProtocol := &AccountManagementProtocol{
+		server:                   server,
+		FindByNameLikeMaxResults: DefaultFindByNameLikeMaxResults,
+	}
 
 	accountManagementProtocol.Setup()
 
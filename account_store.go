@@ -0,0 +1,285 @@
+package nexproto
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrAccountNotFound is returned by an AccountStore when no account matches
+	ErrAccountNotFound = errors.New("[AccountStore] Account not found")
+
+	// ErrAccountExists is returned by an AccountStore when the name or PID is already taken
+	ErrAccountExists = errors.New("[AccountStore] Account already exists")
+)
+
+// PlatformIdentity links an account to a console profile, e.g. an Xbox 360 XUID or a Wii friend code
+type PlatformIdentity struct {
+	Platform string
+	ID       string
+}
+
+// Account holds an account managed through the Account Management protocol.
+// Only the Kerberos key derived from the account key with DeriveKerberosKey is stored
+type Account struct {
+	PID                uint32
+	Name               string
+	KerberosKey        []byte
+	Groups             uint32
+	Email              string
+	Status             string
+	PlatformIdentities []PlatformIdentity
+}
+
+// AccountStore stores the accounts used by the default Account Management protocol handlers
+type AccountStore interface {
+	CreateAccount(account *Account) (*Account, error)
+	LookupAccountByPID(pid uint32) (*Account, error)
+	LookupAccountByName(name string) (*Account, error)
+	LookupAccountByPlatformIdentity(identity PlatformIdentity) (*Account, error)
+	LinkPlatformIdentity(pid uint32, identity PlatformIdentity) error
+	UpdateAccount(account *Account) error
+	DeleteAccount(pid uint32) error
+	FindAccountsByName(pattern *NameLikePattern, groups uint32, resultRange *ResultRange) ([]*Account, error)
+}
+
+// MemoryAccountStore is an AccountStore which keeps accounts in memory
+type MemoryAccountStore struct {
+	mutex    sync.RWMutex
+	nextPID  uint32
+	accounts map[uint32]*Account
+	names    map[string]uint32
+	links    map[PlatformIdentity]uint32
+}
+
+// CreateAccount stores a new account, assigning the next free PID if account.PID is 0
+func (memoryAccountStore *MemoryAccountStore) CreateAccount(account *Account) (*Account, error) {
+	memoryAccountStore.mutex.Lock()
+	defer memoryAccountStore.mutex.Unlock()
+
+	name := strings.ToLower(account.Name)
+
+	if _, ok := memoryAccountStore.names[name]; ok {
+		return nil, ErrAccountExists
+	}
+
+	for _, identity := range account.PlatformIdentities {
+		if _, ok := memoryAccountStore.links[identity]; ok {
+			return nil, ErrAccountExists
+		}
+	}
+
+	created := copyAccount(account)
+
+	if created.PID == 0 {
+		for {
+			created.PID = memoryAccountStore.nextPID
+			memoryAccountStore.nextPID++
+
+			// PID 0 is what clients which haven't logged in have
+			if created.PID == 0 {
+				continue
+			}
+
+			if _, ok := memoryAccountStore.accounts[created.PID]; !ok {
+				break
+			}
+		}
+	} else if _, ok := memoryAccountStore.accounts[created.PID]; ok {
+		return nil, ErrAccountExists
+	}
+
+	memoryAccountStore.accounts[created.PID] = created
+	memoryAccountStore.names[name] = created.PID
+
+	for _, identity := range created.PlatformIdentities {
+		memoryAccountStore.links[identity] = created.PID
+	}
+
+	return copyAccount(created), nil
+}
+
+// LookupAccountByPID returns the account with the given PID
+func (memoryAccountStore *MemoryAccountStore) LookupAccountByPID(pid uint32) (*Account, error) {
+	memoryAccountStore.mutex.RLock()
+	defer memoryAccountStore.mutex.RUnlock()
+
+	return memoryAccountStore.lookup(pid)
+}
+
+// LookupAccountByName returns the account with the given name, ignoring case
+func (memoryAccountStore *MemoryAccountStore) LookupAccountByName(name string) (*Account, error) {
+	memoryAccountStore.mutex.RLock()
+	defer memoryAccountStore.mutex.RUnlock()
+
+	pid, ok := memoryAccountStore.names[strings.ToLower(name)]
+
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	return memoryAccountStore.lookup(pid)
+}
+
+// LookupAccountByPlatformIdentity returns the account linked to a console profile
+func (memoryAccountStore *MemoryAccountStore) LookupAccountByPlatformIdentity(identity PlatformIdentity) (*Account, error) {
+	memoryAccountStore.mutex.RLock()
+	defer memoryAccountStore.mutex.RUnlock()
+
+	pid, ok := memoryAccountStore.links[identity]
+
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	return memoryAccountStore.lookup(pid)
+}
+
+// LinkPlatformIdentity links a console profile to an account
+func (memoryAccountStore *MemoryAccountStore) LinkPlatformIdentity(pid uint32, identity PlatformIdentity) error {
+	memoryAccountStore.mutex.Lock()
+	defer memoryAccountStore.mutex.Unlock()
+
+	account, ok := memoryAccountStore.accounts[pid]
+
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	if linkedPID, ok := memoryAccountStore.links[identity]; ok {
+		if linkedPID == pid {
+			return nil
+		}
+
+		return ErrAccountExists
+	}
+
+	account.PlatformIdentities = append(account.PlatformIdentities, identity)
+	memoryAccountStore.links[identity] = pid
+
+	return nil
+}
+
+// UpdateAccount replaces the name, Kerberos key, groups, email and status of an existing account
+func (memoryAccountStore *MemoryAccountStore) UpdateAccount(account *Account) error {
+	memoryAccountStore.mutex.Lock()
+	defer memoryAccountStore.mutex.Unlock()
+
+	existing, ok := memoryAccountStore.accounts[account.PID]
+
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	oldName := strings.ToLower(existing.Name)
+	newName := strings.ToLower(account.Name)
+
+	if oldName != newName {
+		if _, ok := memoryAccountStore.names[newName]; ok {
+			return ErrAccountExists
+		}
+
+		delete(memoryAccountStore.names, oldName)
+		memoryAccountStore.names[newName] = account.PID
+	}
+
+	existing.Name = account.Name
+	existing.KerberosKey = bytes.Clone(account.KerberosKey)
+	existing.Groups = account.Groups
+	existing.Email = account.Email
+	existing.Status = account.Status
+
+	return nil
+}
+
+// DeleteAccount removes an account and its console profile links
+func (memoryAccountStore *MemoryAccountStore) DeleteAccount(pid uint32) error {
+	memoryAccountStore.mutex.Lock()
+	defer memoryAccountStore.mutex.Unlock()
+
+	account, ok := memoryAccountStore.accounts[pid]
+
+	if !ok {
+		return ErrAccountNotFound
+	}
+
+	for _, identity := range account.PlatformIdentities {
+		delete(memoryAccountStore.links, identity)
+	}
+
+	delete(memoryAccountStore.names, strings.ToLower(account.Name))
+	delete(memoryAccountStore.accounts, pid)
+
+	return nil
+}
+
+// FindAccountsByName returns the accounts whose name matches pattern and which are in any of groups.
+// A groups value of 0 matches every account. Results are ordered by PID before resultRange is applied
+func (memoryAccountStore *MemoryAccountStore) FindAccountsByName(pattern *NameLikePattern, groups uint32, resultRange *ResultRange) ([]*Account, error) {
+	memoryAccountStore.mutex.RLock()
+	defer memoryAccountStore.mutex.RUnlock()
+
+	accounts := make([]*Account, 0)
+
+	for _, account := range memoryAccountStore.accounts {
+		if groups != 0 && account.Groups&groups == 0 {
+			continue
+		}
+
+		if pattern.Match(account.Name) {
+			accounts = append(accounts, copyAccount(account))
+		}
+	}
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].PID < accounts[j].PID
+	})
+
+	if resultRange.Offset >= uint32(len(accounts)) {
+		return accounts[:0], nil
+	}
+
+	accounts = accounts[resultRange.Offset:]
+
+	if resultRange.Size < uint32(len(accounts)) {
+		accounts = accounts[:resultRange.Size]
+	}
+
+	return accounts, nil
+}
+
+// lookup returns a copy of an account. Must be called with mutex held
+func (memoryAccountStore *MemoryAccountStore) lookup(pid uint32) (*Account, error) {
+	account, ok := memoryAccountStore.accounts[pid]
+
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+
+	return copyAccount(account), nil
+}
+
+// NewMemoryAccountStore returns a new MemoryAccountStore which hands out PIDs starting at firstPID, which can't be lower than 1
+func NewMemoryAccountStore(firstPID uint32) *MemoryAccountStore {
+	if firstPID == 0 {
+		firstPID = 1
+	}
+
+	return &MemoryAccountStore{
+		nextPID:  firstPID,
+		accounts: make(map[uint32]*Account),
+		names:    make(map[string]uint32),
+		links:    make(map[PlatformIdentity]uint32),
+	}
+}
+
+func copyAccount(account *Account) *Account {
+	accountCopy := *account
+	accountCopy.KerberosKey = bytes.Clone(account.KerberosKey)
+	accountCopy.PlatformIdentities = append([]PlatformIdentity(nil), account.PlatformIdentities...)
+
+	return &accountCopy
+}
@@ -0,0 +1,121 @@
+package nexproto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMemoryAccountStoreSkipsPIDZero(t *testing.T) {
+	memoryAccountStore := NewMemoryAccountStore(0)
+
+	account, err := memoryAccountStore.CreateAccount(&Account{Name: "alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if account.PID == 0 {
+		t.Fatal("account was created with PID 0")
+	}
+}
+
+func TestMemoryAccountStoreKerberosKeyIsCopied(t *testing.T) {
+	memoryAccountStore := NewMemoryAccountStore(1000)
+
+	account, err := memoryAccountStore.CreateAccount(&Account{Name: "alice", KerberosKey: []byte{1, 2, 3}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account.KerberosKey[0] = 9
+
+	stored, err := memoryAccountStore.LookupAccountByPID(account.PID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stored.KerberosKey, []byte{1, 2, 3}) {
+		t.Fatalf("stored key changed through a returned account: %v", stored.KerberosKey)
+	}
+}
+
+func TestAccountManagementCreateAccount(t *testing.T) {
+	memoryAuthenticator := NewMemoryAuthenticator()
+	accountManagementProtocol := &AccountManagementProtocol{
+		AccountStore:  NewMemoryAccountStore(1000),
+		Authenticator: memoryAuthenticator,
+	}
+
+	account, err := accountManagementProtocol.createAccount(&Account{Name: "alice"}, "secret key")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := accountManagementProtocol.AccountStore.LookupAccountByName("alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(stored.KerberosKey, DeriveKerberosKey(account.PID, []byte("secret key"))) {
+		t.Fatal("stored key is not the key derived from the account key")
+	}
+
+	tests := []struct {
+		name  string
+		key   string
+		match bool
+	}{
+		{"right key", "secret key", true},
+		{"wrong key", "secret kez", false},
+		{"empty key", "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if accountKeyMatches(stored, test.key) != test.match {
+				t.Fatalf("got match %v, want %v", !test.match, test.match)
+			}
+		})
+	}
+
+	// the account must be able to log in with the key it was created with
+	if pid, err := memoryAuthenticator.LookupPID("alice"); err != nil || pid != account.PID {
+		t.Fatalf("got %d, %v from the authenticator", pid, err)
+	}
+
+	if err := memoryAuthenticator.VerifyToken(account.PID, &AuthenticationInfo{Token: "secret key"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := accountManagementProtocol.createAccount(&Account{Name: "ALICE"}, "other"); !errors.Is(err, ErrAccountExists) {
+		t.Fatalf("got %v, want ErrAccountExists", err)
+	}
+}
+
+type failingAccountAuthenticator struct {
+	*MemoryAuthenticator
+}
+
+func (failingAccountAuthenticator *failingAccountAuthenticator) AddAccountKey(pid uint32, username string, key []byte) error {
+	return errors.New("authenticator unavailable")
+}
+
+func TestAccountManagementCreateAccountRollsBack(t *testing.T) {
+	accountManagementProtocol := &AccountManagementProtocol{
+		AccountStore:  NewMemoryAccountStore(1000),
+		Authenticator: &failingAccountAuthenticator{NewMemoryAuthenticator()},
+	}
+
+	if _, err := accountManagementProtocol.createAccount(&Account{Name: "alice"}, "secret key"); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if _, err := accountManagementProtocol.AccountStore.LookupAccountByName("alice"); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("got %v, want the account to be removed again", err)
+	}
+}
@@ -3,6 +3,7 @@ package nexproto
 import (
 	"errors"
 	"log"
+	"time"
 
 	nex "github.com/ihatecompvir/nex-go"
 )
@@ -38,7 +39,20 @@ type AuthenticationProtocol struct {
 	RequestTicketHandler  func(err error, client *nex.Client, callID uint32, userPID uint32, serverPID uint32)
 	GetPIDHandler         func(err error, client *nex.Client, callID uint32, username string)
 	GetNameHandler        func(err error, client *nex.Client, callID uint32, userPID uint32)
-	LoginWithParamHandler func(err error, client *nex.Client, callID uint32)
+	LoginWithParamHandler func(err error, client *nex.Client, callID uint32, username string, loginParam *LoginParam)
+	TicketStore           TicketStore
+	TicketLifetime        time.Duration
+
+	// Authenticator, when set, answers Login, LoginEx, RequestTicket, GetPID and GetName
+	// for which no handler has been set, issuing tickets for the Secure server below
+	Authenticator        Authenticator
+	SecureServerPID      uint32
+	SecureServerPassword string
+	SecureStationURL     string
+	ServerBuildName      string
+
+	// LoginThrottle, when set, refuses Login and LoginEx attempts after too many failures
+	LoginThrottle *LoginThrottle
 }
 
 // NintendoLoginData holds a nex auth token
@@ -102,6 +116,62 @@ func NewAuthenticationInfo() *AuthenticationInfo {
 	return authenticationInfo
 }
 
+// LoginParam holds the data holder sent with LoginWithParam
+type LoginParam struct {
+	DataHolderName     string
+	Data               []byte
+	AuthenticationInfo *AuthenticationInfo // only set when the data holder is an AuthenticationInfo
+}
+
+// RVConnectionData holds the station URLs a client connects to after logging in
+type RVConnectionData struct {
+	StationURL                 string
+	SpecialProtocols           []uint8
+	StationURLSpecialProtocols string
+}
+
+// Bytes encodes the RVConnectionData and returns a byte array
+func (rvConnectionData *RVConnectionData) Bytes(stream *StreamOut) []byte {
+	stream.Write4ByteString(rvConnectionData.StationURL)
+
+	stream.WriteUInt32LE(uint32(len(rvConnectionData.SpecialProtocols)))
+	for _, specialProtocol := range rvConnectionData.SpecialProtocols {
+		stream.WriteUInt8(specialProtocol)
+	}
+
+	stream.Write4ByteString(rvConnectionData.StationURLSpecialProtocols)
+
+	return stream.Bytes()
+}
+
+// LoginResponse holds the response to Login and LoginEx
+type LoginResponse struct {
+	Result         uint32
+	PID            uint32
+	Ticket         []byte
+	ConnectionData *RVConnectionData
+	ServerName     string
+}
+
+// Bytes encodes the LoginResponse and returns a byte array
+func (loginResponse *LoginResponse) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt32LE(loginResponse.Result)
+	stream.WriteUInt32LE(loginResponse.PID)
+	stream.WriteBuffer(loginResponse.Ticket)
+
+	connectionData := loginResponse.ConnectionData
+
+	if connectionData == nil {
+		connectionData = &RVConnectionData{}
+	}
+
+	connectionData.Bytes(stream)
+
+	stream.Write4ByteString(loginResponse.ServerName)
+
+	return stream.Bytes()
+}
+
 // Setup initializes the protocol
 func (authenticationProtocol *AuthenticationProtocol) Setup() {
 	nexServer := authenticationProtocol.server
@@ -156,12 +226,18 @@ func (authenticationProtocol *AuthenticationProtocol) GetName(handler func(err e
 }
 
 // LoginWithParam sets the LoginWithParam handler function
-func (authenticationProtocol *AuthenticationProtocol) LoginWithParam(handler func(err error, client *nex.Client, callID uint32)) {
+func (authenticationProtocol *AuthenticationProtocol) LoginWithParam(handler func(err error, client *nex.Client, callID uint32, username string, loginParam *LoginParam)) {
 	authenticationProtocol.LoginWithParamHandler = handler
 }
 
 func (authenticationProtocol *AuthenticationProtocol) handleLogin(packet nex.PacketInterface) {
-	if authenticationProtocol.LoginHandler == nil {
+	handler := authenticationProtocol.LoginHandler
+
+	if handler == nil && authenticationProtocol.Authenticator != nil {
+		handler = authenticationProtocol.defaultLogin
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AuthenticationProtocol::Login not implemented")
 		go respondNotImplemented(packet, AuthenticationProtocolID)
 		return
@@ -178,15 +254,25 @@ func (authenticationProtocol *AuthenticationProtocol) handleLogin(packet nex.Pac
 	username, err := parametersStream.Read4ByteString()
 
 	if err != nil {
-		go authenticationProtocol.LoginHandler(err, client, callID, "")
+		go handler(err, client, callID, "")
 		return
 	}
 
-	go authenticationProtocol.LoginHandler(nil, client, callID, username)
+	if !authenticationProtocol.allowLogin(packet, username) {
+		return
+	}
+
+	go handler(nil, client, callID, username)
 }
 
 func (authenticationProtocol *AuthenticationProtocol) handleLoginEx(packet nex.PacketInterface) {
-	if authenticationProtocol.LoginExHandler == nil {
+	handler := authenticationProtocol.LoginExHandler
+
+	if handler == nil && authenticationProtocol.Authenticator != nil {
+		handler = authenticationProtocol.defaultLoginEx
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AuthenticationProtocol::LoginEx not implemented")
 		go respondNotImplemented(packet, AuthenticationProtocolID)
 		return
@@ -203,20 +289,20 @@ func (authenticationProtocol *AuthenticationProtocol) handleLoginEx(packet nex.P
 	username, err := parametersStream.ReadString()
 
 	if err != nil {
-		go authenticationProtocol.LoginExHandler(err, client, callID, "", nil)
+		go handler(err, client, callID, "", nil)
 		return
 	}
 
 	dataHolderName, err := parametersStream.ReadString()
 
 	if err != nil {
-		go authenticationProtocol.LoginExHandler(err, client, callID, "", nil)
+		go handler(err, client, callID, "", nil)
 		return
 	}
 
 	if dataHolderName != "AuthenticationInfo" {
 		err := errors.New("[AuthenticationProtocol::LoginEx] Data holder name does not match")
-		go authenticationProtocol.LoginExHandler(err, client, callID, "", nil)
+		go handler(err, client, callID, "", nil)
 		return
 	}
 
@@ -225,7 +311,7 @@ func (authenticationProtocol *AuthenticationProtocol) handleLoginEx(packet nex.P
 	dataHolderContent, err := parametersStream.ReadBuffer()
 
 	if err != nil {
-		go authenticationProtocol.LoginExHandler(err, client, callID, "", nil)
+		go handler(err, client, callID, "", nil)
 		return
 	}
 
@@ -234,15 +320,25 @@ func (authenticationProtocol *AuthenticationProtocol) handleLoginEx(packet nex.P
 	authenticationInfo, err := dataHolderContentStream.ReadStructure(NewAuthenticationInfo())
 
 	if err != nil {
-		go authenticationProtocol.LoginExHandler(err, client, callID, "", nil)
+		go handler(err, client, callID, "", nil)
+		return
+	}
+
+	if !authenticationProtocol.allowLogin(packet, username) {
 		return
 	}
 
-	go authenticationProtocol.LoginExHandler(nil, client, callID, username, authenticationInfo.(*AuthenticationInfo))
+	go handler(nil, client, callID, username, authenticationInfo.(*AuthenticationInfo))
 }
 
 func (authenticationProtocol *AuthenticationProtocol) handleRequestTicket(packet nex.PacketInterface) {
-	if authenticationProtocol.RequestTicketHandler == nil {
+	handler := authenticationProtocol.RequestTicketHandler
+
+	if handler == nil && authenticationProtocol.Authenticator != nil {
+		handler = authenticationProtocol.defaultRequestTicket
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AuthenticationProtocol::RequestTicket not implemented")
 		go respondNotImplemented(packet, AuthenticationProtocolID)
 		return
@@ -256,7 +352,8 @@ func (authenticationProtocol *AuthenticationProtocol) handleRequestTicket(packet
 
 	if len(parameters) != 8 {
 		err := errors.New("[AuthenticationProtocol::RequestTicket] Parameters length not 8")
-		go authenticationProtocol.RequestTicketHandler(err, client, callID, 0, 0)
+		go handler(err, client, callID, 0, 0)
+		return
 	}
 
 	parametersStream := nex.NewStreamIn(parameters, authenticationProtocol.server)
@@ -264,11 +361,17 @@ func (authenticationProtocol *AuthenticationProtocol) handleRequestTicket(packet
 	userPID := parametersStream.ReadUInt32LE()
 	serverPID := parametersStream.ReadUInt8()
 
-	go authenticationProtocol.RequestTicketHandler(nil, client, callID, userPID, uint32(serverPID))
+	go handler(nil, client, callID, userPID, uint32(serverPID))
 }
 
 func (authenticationProtocol *AuthenticationProtocol) handleGetPID(packet nex.PacketInterface) {
-	if authenticationProtocol.GetPIDHandler == nil {
+	handler := authenticationProtocol.GetPIDHandler
+
+	if handler == nil && authenticationProtocol.Authenticator != nil {
+		handler = authenticationProtocol.defaultGetPID
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AuthenticationProtocol::GetPID not implemented")
 		go respondNotImplemented(packet, AuthenticationProtocolID)
 		return
@@ -285,15 +388,21 @@ func (authenticationProtocol *AuthenticationProtocol) handleGetPID(packet nex.Pa
 	username, err := parametersStream.ReadString()
 
 	if err != nil {
-		go authenticationProtocol.GetPIDHandler(err, client, callID, "")
+		go handler(err, client, callID, "")
 		return
 	}
 
-	go authenticationProtocol.GetPIDHandler(nil, client, callID, username)
+	go handler(nil, client, callID, username)
 }
 
 func (authenticationProtocol *AuthenticationProtocol) handleGetName(packet nex.PacketInterface) {
-	if authenticationProtocol.GetNameHandler == nil {
+	handler := authenticationProtocol.GetNameHandler
+
+	if handler == nil && authenticationProtocol.Authenticator != nil {
+		handler = authenticationProtocol.defaultGetName
+	}
+
+	if handler == nil {
 		log.Println("[Warning] AuthenticationProtocol::GetName not implemented")
 		go respondNotImplemented(packet, AuthenticationProtocolID)
 		return
@@ -309,12 +418,13 @@ func (authenticationProtocol *AuthenticationProtocol) handleGetName(packet nex.P
 
 	if len(parameters) != 4 {
 		err := errors.New("[AuthenticationProtocol::GetName] Parameters length not 4")
-		go authenticationProtocol.RequestTicketHandler(err, client, callID, 0, 0)
+		go handler(err, client, callID, 0)
+		return
 	}
 
 	userPID := parametersStream.ReadUInt32LE()
 
-	go authenticationProtocol.GetNameHandler(nil, client, callID, userPID)
+	go handler(nil, client, callID, userPID)
 }
 
 func (authenticationProtocol *AuthenticationProtocol) handleLoginWithParam(packet nex.PacketInterface) {
@@ -324,12 +434,335 @@ func (authenticationProtocol *AuthenticationProtocol) handleLoginWithParam(packe
 		return
 	}
 
-	// Unsure what data is sent here, or how to trigger the console to send it
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, authenticationProtocol.server)
+
+	username, err := parametersStream.Read4ByteString()
+
+	if err != nil {
+		go authenticationProtocol.LoginWithParamHandler(err, client, callID, "", nil)
+		return
+	}
+
+	dataHolder, err := parametersStream.ReadDataHolder()
+
+	if err != nil {
+		go authenticationProtocol.LoginWithParamHandler(err, client, callID, "", nil)
+		return
+	}
+
+	loginParam := &LoginParam{
+		DataHolderName: dataHolder.Name,
+		Data:           dataHolder.Data,
+	}
+
+	if dataHolder.Name == "AuthenticationInfo" {
+		dataHolderContentStream := nex.NewStreamIn(dataHolder.Data, authenticationProtocol.server)
+
+		authenticationInfo, err := dataHolderContentStream.ReadStructure(NewAuthenticationInfo())
+
+		if err != nil {
+			go authenticationProtocol.LoginWithParamHandler(err, client, callID, "", nil)
+			return
+		}
+
+		loginParam.AuthenticationInfo = authenticationInfo.(*AuthenticationInfo)
+	}
+
+	go authenticationProtocol.LoginWithParamHandler(nil, client, callID, username, loginParam)
+}
+
+// RespondLogin sends a Login response to the client
+func (authenticationProtocol *AuthenticationProtocol) RespondLogin(client *nex.Client, callID uint32, loginResponse *LoginResponse) {
+	authenticationProtocol.respondLogin(client, callID, AuthenticationMethodLogin, loginResponse)
+}
+
+// RespondLoginEx sends a LoginEx response to the client
+func (authenticationProtocol *AuthenticationProtocol) RespondLoginEx(client *nex.Client, callID uint32, loginResponse *LoginResponse) {
+	authenticationProtocol.respondLogin(client, callID, AuthenticationMethodLoginEx, loginResponse)
+}
+
+func (authenticationProtocol *AuthenticationProtocol) respondLogin(client *nex.Client, callID uint32, methodID uint32, loginResponse *LoginResponse) {
+	rmcResponseStream := NewStreamOut(authenticationProtocol.server)
+
+	rmcResponseBody := loginResponse.Bytes(rmcResponseStream)
+
+	respondSuccess(client, AuthenticationProtocolID, callID, methodID, rmcResponseBody)
+}
+
+// IssueTicket builds a Kerberos ticket granting userPID access to serverPID and records it in the TicketStore, if one is set.
+// The returned ticket is meant to be sent back as the RequestTicket (or Login) response buffer
+func (authenticationProtocol *AuthenticationProtocol) IssueTicket(userPID uint32, userKey []byte, serverPID uint32, serverKey []byte) ([]byte, error) {
+	keySize := authenticationProtocol.server.KerberosKeySize()
+
+	ticket, internalData, err := BuildKerberosTicket(userPID, userKey, serverPID, serverKey, keySize, authenticationProtocol.TicketLifetime)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if authenticationProtocol.TicketStore != nil {
+		err = authenticationProtocol.TicketStore.AddTicket(&IssuedTicket{
+			UserPID:    userPID,
+			ServerPID:  serverPID,
+			SessionKey: internalData.SessionKey,
+			Expiration: internalData.Expiration,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ticket, nil
+}
+
+// RespondRequestTicket issues a ticket with IssueTicket and sends it as the RequestTicket response.
+// Custom RequestTicket handlers should respond through it so the ticket is recorded in the TicketStore
+// and the Secure server accepts it on connect. If the ticket can't be issued an error response is sent and the error returned
+func (authenticationProtocol *AuthenticationProtocol) RespondRequestTicket(client *nex.Client, callID uint32, userPID uint32, userKey []byte, serverPID uint32, serverKey []byte) error {
+	ticket, err := authenticationProtocol.IssueTicket(userPID, userKey, serverPID, serverKey)
+
+	if err != nil {
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreUnknown)
+		return err
+	}
+
+	rmcResponseStream := NewStreamOut(authenticationProtocol.server)
+
+	rmcResponseStream.WriteUInt32LE(ResultCodeSuccess)
+	rmcResponseStream.WriteBuffer(ticket)
+
+	respondSuccess(client, AuthenticationProtocolID, callID, AuthenticationMethodRequestTicket, rmcResponseStream.Bytes())
+
+	return nil
+}
+
+// LoginFailed records a failed Login or LoginEx attempt with the LoginThrottle, if one is set
+func (authenticationProtocol *AuthenticationProtocol) LoginFailed(client *nex.Client, username string) {
+	if authenticationProtocol.LoginThrottle != nil {
+		authenticationProtocol.LoginThrottle.RecordFailure(client.Address().IP.String(), username)
+	}
+}
+
+// LoginSucceeded records a login which proved the password, e.g. a verified LoginEx, with the LoginThrottle, if one is set
+func (authenticationProtocol *AuthenticationProtocol) LoginSucceeded(client *nex.Client, username string) {
+	if authenticationProtocol.LoginThrottle != nil {
+		authenticationProtocol.LoginThrottle.RecordSuccess(client.Address().IP.String(), username)
+	}
+}
+
+// allowLogin checks the LoginThrottle and responds with an error if the attempt is refused
+func (authenticationProtocol *AuthenticationProtocol) allowLogin(packet nex.PacketInterface, username string) bool {
+	if authenticationProtocol.LoginThrottle == nil {
+		return true
+	}
+
+	address := packet.Sender().Address().IP.String()
+
+	err := authenticationProtocol.LoginThrottle.Check(address, username)
+
+	if err == nil {
+		return true
+	}
+
+	log.Printf("[Warning] AuthenticationProtocol refused login for %s from %s: %s\n", username, address, err)
+
+	if errors.Is(err, ErrLoginLockedOut) {
+		go respondError(packet, AuthenticationProtocolID, ResultCodeRendezVousAccountTemporarilyDisabled)
+	} else {
+		go respondError(packet, AuthenticationProtocolID, ResultCodeCoreAccessDenied)
+	}
+
+	return false
+}
+
+func (authenticationProtocol *AuthenticationProtocol) defaultLogin(err error, client *nex.Client, callID uint32, username string) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	pid, err := authenticationProtocol.Authenticator.LookupPID(username)
+
+	if err != nil {
+		authenticationProtocol.LoginFailed(client, username)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidUsername)
+		return
+	}
+
+	loginResponse, err := authenticationProtocol.defaultLoginResponse(pid)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	// Login proves nothing until the client connects with the ticket, so it must not reset the throttle
+	authenticationProtocol.RespondLogin(client, callID, loginResponse)
+}
+
+func (authenticationProtocol *AuthenticationProtocol) defaultLoginEx(err error, client *nex.Client, callID uint32, username string, authenticationInfo *AuthenticationInfo) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	pid, err := authenticationProtocol.Authenticator.LookupPID(username)
+
+	if err != nil {
+		authenticationProtocol.LoginFailed(client, username)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidUsername)
+		return
+	}
+
+	if err := authenticationProtocol.Authenticator.VerifyToken(pid, authenticationInfo); err != nil {
+		authenticationProtocol.LoginFailed(client, username)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidPassword)
+		return
+	}
+
+	loginResponse, err := authenticationProtocol.defaultLoginResponse(pid)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	authenticationProtocol.LoginSucceeded(client, username)
+	authenticationProtocol.RespondLoginEx(client, callID, loginResponse)
+}
+
+func (authenticationProtocol *AuthenticationProtocol) defaultLoginResponse(pid uint32) (*LoginResponse, error) {
+	ticket, err := authenticationProtocol.issueSecureServerTicket(pid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	loginResponse := &LoginResponse{
+		Result: ResultCodeSuccess,
+		PID:    pid,
+		Ticket: ticket,
+		ConnectionData: &RVConnectionData{
+			StationURL: authenticationProtocol.SecureStationURL,
+		},
+		ServerName: authenticationProtocol.ServerBuildName,
+	}
+
+	return loginResponse, nil
+}
+
+func (authenticationProtocol *AuthenticationProtocol) issueSecureServerTicket(pid uint32) ([]byte, error) {
+	userKey, serverKey, err := authenticationProtocol.secureServerKeys(pid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return authenticationProtocol.IssueTicket(pid, userKey, authenticationProtocol.SecureServerPID, serverKey)
+}
+
+// secureServerKeys returns the Kerberos keys of a user and of the Secure server
+func (authenticationProtocol *AuthenticationProtocol) secureServerKeys(pid uint32) ([]byte, []byte, error) {
+	userKey, err := authenticationProtocol.Authenticator.LookupKey(pid)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serverKey := DeriveKerberosKey(authenticationProtocol.SecureServerPID, []byte(authenticationProtocol.SecureServerPassword))
+
+	return userKey, serverKey, nil
+}
+
+func (authenticationProtocol *AuthenticationProtocol) defaultRequestTicket(err error, client *nex.Client, callID uint32, userPID uint32, serverPID uint32) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if serverPID != authenticationProtocol.SecureServerPID {
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidPID)
+		return
+	}
+
+	userKey, serverKey, err := authenticationProtocol.secureServerKeys(userPID)
+
+	if errors.Is(err, ErrPrincipalNotFound) {
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidPID)
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	if err := authenticationProtocol.RespondRequestTicket(client, callID, userPID, userKey, serverPID, serverKey); err != nil {
+		log.Println(err)
+	}
+}
+
+func (authenticationProtocol *AuthenticationProtocol) defaultGetPID(err error, client *nex.Client, callID uint32, username string) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	pid, err := authenticationProtocol.Authenticator.LookupPID(username)
+
+	if err != nil {
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidUsername)
+		return
+	}
+
+	rmcResponseStream := NewStreamOut(authenticationProtocol.server)
+
+	rmcResponseStream.WriteUInt32LE(pid)
+
+	respondSuccess(client, AuthenticationProtocolID, callID, AuthenticationMethodGetPID, rmcResponseStream.Bytes())
+}
+
+func (authenticationProtocol *AuthenticationProtocol) defaultGetName(err error, client *nex.Client, callID uint32, userPID uint32) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	name, err := authenticationProtocol.Authenticator.LookupName(userPID)
+
+	if err != nil {
+		respondErrorCode(client, AuthenticationProtocolID, callID, ResultCodeRendezVousInvalidPID)
+		return
+	}
+
+	rmcResponseStream := NewStreamOut(authenticationProtocol.server)
+
+	rmcResponseStream.Write4ByteString(name)
+
+	respondSuccess(client, AuthenticationProtocolID, callID, AuthenticationMethodGetName, rmcResponseStream.Bytes())
 }
 
 // NewAuthenticationProtocol returns a new AuthenticationProtocol
 func NewAuthenticationProtocol(server *nex.Server) *AuthenticationProtocol {
-	authenticationProtocol := &AuthenticationProtocol{server: server}
+	authenticationProtocol := &AuthenticationProtocol{
+		server:         server,
+		TicketLifetime: time.Hour,
+	}
 
 	authenticationProtocol.Setup()
 
@@ -0,0 +1,273 @@
+package nexproto
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrPrincipalNotFound is returned by an Authenticator when no account matches
+	ErrPrincipalNotFound = errors.New("[Authenticator] Principal not found")
+
+	// ErrInvalidCredentials is returned by an Authenticator when a token does not match the account
+	ErrInvalidCredentials = errors.New("[Authenticator] Invalid credentials")
+)
+
+// Authenticator verifies credentials for the default Authentication protocol handlers.
+// Login does not carry a password, it is proven by the client being able to decrypt
+// a ticket encrypted with the Kerberos key returned by LookupKey.
+// Only the key derived with DeriveKerberosKey needs to be stored, never the password itself
+type Authenticator interface {
+	LookupPID(username string) (uint32, error)
+	LookupName(pid uint32) (string, error)
+	LookupKey(pid uint32) ([]byte, error)
+	VerifyToken(pid uint32, authenticationInfo *AuthenticationInfo) error
+}
+
+// AccountAuthenticator is an Authenticator new accounts can be added to, e.g. by the default
+// Account Management handlers. key is the Kerberos key derived with DeriveKerberosKey
+type AccountAuthenticator interface {
+	Authenticator
+	AddAccountKey(pid uint32, username string, key []byte) error
+}
+
+type memoryAuthenticatorAccount struct {
+	username string
+	key      []byte
+}
+
+// MemoryAuthenticator is an Authenticator which keeps accounts in memory
+type MemoryAuthenticator struct {
+	mutex    sync.RWMutex
+	pids     map[string]uint32
+	accounts map[uint32]*memoryAuthenticatorAccount
+	keyCache derivedKeyCache
+}
+
+// AddAccount adds or replaces an account. Only the Kerberos key derived from the password is kept
+func (memoryAuthenticator *MemoryAuthenticator) AddAccount(pid uint32, username string, password string) error {
+	return memoryAuthenticator.AddAccountKey(pid, username, DeriveKerberosKey(pid, []byte(password)))
+}
+
+// AddAccountKey adds or replaces an account with an already derived Kerberos key.
+// Like the SQL table, an account already using the username is replaced
+func (memoryAuthenticator *MemoryAuthenticator) AddAccountKey(pid uint32, username string, key []byte) error {
+	memoryAuthenticator.mutex.Lock()
+	defer memoryAuthenticator.mutex.Unlock()
+
+	if account, ok := memoryAuthenticator.accounts[pid]; ok {
+		delete(memoryAuthenticator.pids, account.username)
+	}
+
+	if otherPID, ok := memoryAuthenticator.pids[username]; ok {
+		delete(memoryAuthenticator.accounts, otherPID)
+	}
+
+	memoryAuthenticator.pids[username] = pid
+	memoryAuthenticator.accounts[pid] = &memoryAuthenticatorAccount{
+		username: username,
+		key:      bytes.Clone(key),
+	}
+
+	return nil
+}
+
+// LookupPID returns the PID of the account with the given username
+func (memoryAuthenticator *MemoryAuthenticator) LookupPID(username string) (uint32, error) {
+	memoryAuthenticator.mutex.RLock()
+	defer memoryAuthenticator.mutex.RUnlock()
+
+	pid, ok := memoryAuthenticator.pids[username]
+
+	if !ok {
+		return 0, ErrPrincipalNotFound
+	}
+
+	return pid, nil
+}
+
+// LookupName returns the username of the account with the given PID
+func (memoryAuthenticator *MemoryAuthenticator) LookupName(pid uint32) (string, error) {
+	account, err := memoryAuthenticator.account(pid)
+
+	if err != nil {
+		return "", err
+	}
+
+	return account.username, nil
+}
+
+// LookupKey returns the Kerberos key of the account with the given PID
+func (memoryAuthenticator *MemoryAuthenticator) LookupKey(pid uint32) ([]byte, error) {
+	account, err := memoryAuthenticator.account(pid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return account.key, nil
+}
+
+// VerifyToken checks that the AuthenticationInfo token derives the Kerberos key of the account
+func (memoryAuthenticator *MemoryAuthenticator) VerifyToken(pid uint32, authenticationInfo *AuthenticationInfo) error {
+	account, err := memoryAuthenticator.account(pid)
+
+	if err != nil {
+		return err
+	}
+
+	return memoryAuthenticator.keyCache.verifyToken(pid, account.key, authenticationInfo)
+}
+
+func (memoryAuthenticator *MemoryAuthenticator) account(pid uint32) (*memoryAuthenticatorAccount, error) {
+	memoryAuthenticator.mutex.RLock()
+	defer memoryAuthenticator.mutex.RUnlock()
+
+	account, ok := memoryAuthenticator.accounts[pid]
+
+	if !ok {
+		return nil, ErrPrincipalNotFound
+	}
+
+	return account, nil
+}
+
+// NewMemoryAuthenticator returns a new MemoryAuthenticator
+func NewMemoryAuthenticator() *MemoryAuthenticator {
+	return &MemoryAuthenticator{
+		pids:     make(map[string]uint32),
+		accounts: make(map[uint32]*memoryAuthenticatorAccount),
+	}
+}
+
+// SQLAuthenticator is an Authenticator backed by a database/sql table.
+// Queries only use plain SQL with ? placeholders so any SQLite driver works
+type SQLAuthenticator struct {
+	database *sql.DB
+	keyCache derivedKeyCache
+}
+
+// AddAccount adds or replaces an account. Only the Kerberos key derived from the password is stored
+func (sqlAuthenticator *SQLAuthenticator) AddAccount(pid uint32, username string, password string) error {
+	return sqlAuthenticator.AddAccountKey(pid, username, DeriveKerberosKey(pid, []byte(password)))
+}
+
+// AddAccountKey adds or replaces an account with an already derived Kerberos key
+func (sqlAuthenticator *SQLAuthenticator) AddAccountKey(pid uint32, username string, key []byte) error {
+	_, err := sqlAuthenticator.database.Exec("INSERT OR REPLACE INTO nex_accounts (pid, username, kerberos_key) VALUES (?, ?, ?)", pid, username, key)
+
+	return err
+}
+
+// LookupPID returns the PID of the account with the given username
+func (sqlAuthenticator *SQLAuthenticator) LookupPID(username string) (uint32, error) {
+	var pid uint32
+
+	err := sqlAuthenticator.database.QueryRow("SELECT pid FROM nex_accounts WHERE username = ?", username).Scan(&pid)
+
+	return pid, sqlAuthenticatorError(err)
+}
+
+// LookupName returns the username of the account with the given PID
+func (sqlAuthenticator *SQLAuthenticator) LookupName(pid uint32) (string, error) {
+	var username string
+
+	err := sqlAuthenticator.database.QueryRow("SELECT username FROM nex_accounts WHERE pid = ?", pid).Scan(&username)
+
+	return username, sqlAuthenticatorError(err)
+}
+
+// LookupKey returns the Kerberos key of the account with the given PID
+func (sqlAuthenticator *SQLAuthenticator) LookupKey(pid uint32) ([]byte, error) {
+	var key []byte
+
+	err := sqlAuthenticator.database.QueryRow("SELECT kerberos_key FROM nex_accounts WHERE pid = ?", pid).Scan(&key)
+
+	return key, sqlAuthenticatorError(err)
+}
+
+// VerifyToken checks that the AuthenticationInfo token derives the Kerberos key of the account
+func (sqlAuthenticator *SQLAuthenticator) VerifyToken(pid uint32, authenticationInfo *AuthenticationInfo) error {
+	key, err := sqlAuthenticator.LookupKey(pid)
+
+	if err != nil {
+		return err
+	}
+
+	return sqlAuthenticator.keyCache.verifyToken(pid, key, authenticationInfo)
+}
+
+// NewSQLAuthenticator returns a new SQLAuthenticator, creating the nex_accounts table if it does not exist
+func NewSQLAuthenticator(database *sql.DB) (*SQLAuthenticator, error) {
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS nex_accounts (
+		pid INTEGER PRIMARY KEY,
+		username TEXT NOT NULL UNIQUE,
+		kerberos_key BLOB NOT NULL
+	)`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLAuthenticator{database: database}, nil
+}
+
+func sqlAuthenticatorError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrPrincipalNotFound
+	}
+
+	return err
+}
+
+type derivedKeyCacheEntry struct {
+	tokenHash [sha256.Size]byte
+	key       []byte
+}
+
+// derivedKeyCache remembers the key derived from the last token each PID logged in with,
+// so repeated logins with the same token don't run DeriveKerberosKey again.
+// Tokens are only kept hashed. It does not stop clients guessing different tokens, use a LoginThrottle for that
+type derivedKeyCache struct {
+	mutex   sync.Mutex
+	entries map[uint32]derivedKeyCacheEntry
+}
+
+// deriveKey returns the Kerberos key derived from a PID and token
+func (derivedKeyCache *derivedKeyCache) deriveKey(pid uint32, token string) []byte {
+	tokenHash := sha256.Sum256([]byte(token))
+
+	derivedKeyCache.mutex.Lock()
+	entry, ok := derivedKeyCache.entries[pid]
+	derivedKeyCache.mutex.Unlock()
+
+	if ok && entry.tokenHash == tokenHash {
+		return entry.key
+	}
+
+	key := DeriveKerberosKey(pid, []byte(token))
+
+	derivedKeyCache.mutex.Lock()
+	defer derivedKeyCache.mutex.Unlock()
+
+	if derivedKeyCache.entries == nil {
+		derivedKeyCache.entries = make(map[uint32]derivedKeyCacheEntry)
+	}
+
+	derivedKeyCache.entries[pid] = derivedKeyCacheEntry{tokenHash: tokenHash, key: key}
+
+	return key
+}
+
+// verifyToken checks that the token holds the password the key was derived from
+func (derivedKeyCache *derivedKeyCache) verifyToken(pid uint32, key []byte, authenticationInfo *AuthenticationInfo) error {
+	if authenticationInfo == nil || subtle.ConstantTimeCompare(derivedKeyCache.deriveKey(pid, authenticationInfo.Token), key) != 1 {
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
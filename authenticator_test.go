@@ -0,0 +1,137 @@
+package nexproto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestMemoryAuthenticatorAccounts(t *testing.T) {
+	memoryAuthenticator := NewMemoryAuthenticator()
+	memoryAuthenticator.AddAccount(1000, "alice", "password")
+	memoryAuthenticator.AddAccount(1001, "bob", "hunter2")
+
+	// renaming a PID must free its old username
+	memoryAuthenticator.AddAccount(1000, "carol", "password")
+
+	// taking the username of another PID replaces that account
+	memoryAuthenticator.AddAccount(1002, "bob", "letmein")
+
+	pidTests := []struct {
+		username string
+		pid      uint32
+		err      error
+	}{
+		{"alice", 0, ErrPrincipalNotFound},
+		{"carol", 1000, nil},
+		{"bob", 1002, nil},
+		{"dave", 0, ErrPrincipalNotFound},
+	}
+
+	for _, test := range pidTests {
+		t.Run("LookupPID "+test.username, func(t *testing.T) {
+			pid, err := memoryAuthenticator.LookupPID(test.username)
+
+			if !errors.Is(err, test.err) || pid != test.pid {
+				t.Fatalf("got %d, %v, want %d, %v", pid, err, test.pid, test.err)
+			}
+		})
+	}
+
+	nameTests := []struct {
+		pid      uint32
+		username string
+		err      error
+	}{
+		{1000, "carol", nil},
+		{1001, "", ErrPrincipalNotFound},
+		{1002, "bob", nil},
+	}
+
+	for _, test := range nameTests {
+		t.Run("LookupName "+test.username, func(t *testing.T) {
+			username, err := memoryAuthenticator.LookupName(test.pid)
+
+			if !errors.Is(err, test.err) || username != test.username {
+				t.Fatalf("got %q, %v, want %q, %v", username, err, test.username, test.err)
+			}
+		})
+	}
+
+	key, err := memoryAuthenticator.LookupKey(1000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(key, DeriveKerberosKey(1000, []byte("password"))) {
+		t.Fatal("stored key is not the key derived from the password")
+	}
+}
+
+func TestMemoryAuthenticatorVerifyToken(t *testing.T) {
+	memoryAuthenticator := NewMemoryAuthenticator()
+	memoryAuthenticator.AddAccount(1000, "alice", "password")
+
+	tests := []struct {
+		name               string
+		pid                uint32
+		authenticationInfo *AuthenticationInfo
+		err                error
+	}{
+		{"valid token", 1000, &AuthenticationInfo{Token: "password"}, nil},
+		{"valid token again", 1000, &AuthenticationInfo{Token: "password"}, nil},
+		{"wrong token", 1000, &AuthenticationInfo{Token: "wrong"}, ErrInvalidCredentials},
+		{"valid token after a wrong one", 1000, &AuthenticationInfo{Token: "password"}, nil},
+		{"empty token", 1000, &AuthenticationInfo{}, ErrInvalidCredentials},
+		{"no token", 1000, nil, ErrInvalidCredentials},
+		{"unknown PID", 1001, &AuthenticationInfo{Token: "password"}, ErrPrincipalNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := memoryAuthenticator.VerifyToken(test.pid, test.authenticationInfo)
+
+			if !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+		})
+	}
+
+	// a password change must not be hidden by the cache
+	memoryAuthenticator.AddAccount(1000, "alice", "new password")
+
+	if err := memoryAuthenticator.VerifyToken(1000, &AuthenticationInfo{Token: "password"}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("got %v, want ErrInvalidCredentials for the old password", err)
+	}
+
+	if err := memoryAuthenticator.VerifyToken(1000, &AuthenticationInfo{Token: "new password"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDerivedKeyCache(t *testing.T) {
+	keyCache := &derivedKeyCache{}
+
+	first := keyCache.deriveKey(1000, "password")
+
+	if !bytes.Equal(first, DeriveKerberosKey(1000, []byte("password"))) {
+		t.Fatal("cached key differs from DeriveKerberosKey")
+	}
+
+	if second := keyCache.deriveKey(1000, "password"); &second[0] != &first[0] {
+		t.Fatal("key was derived again for the same token")
+	}
+
+	if other := keyCache.deriveKey(1000, "other"); bytes.Equal(other, first) {
+		t.Fatal("different tokens derived the same key")
+	}
+
+	if other := keyCache.deriveKey(1001, "password"); bytes.Equal(other, first) {
+		t.Fatal("different PIDs derived the same key")
+	}
+
+	if len(keyCache.entries) != 2 {
+		t.Fatalf("got %d cache entries, want one per PID", len(keyCache.entries))
+	}
+}
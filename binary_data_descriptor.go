@@ -0,0 +1,47 @@
+package nexproto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// MaxBinaryDataMetadataLength is the longest RBBinaryData metadata string that will be parsed
+const MaxBinaryDataMetadataLength = 1024
+
+var binaryDataTypeRegex = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// BinaryDataDescriptor describes a RBBinaryData blob for the default RBBinaryData handlers.
+// They expect the metadata string to be a JSON object, e.g. {"type":"band_logo","pid":1234,"slot":0}.
+// This format is a convention of this library, not something the game is known to send,
+// so custom handlers receive the metadata as sent. A PID of 0 refers to the player making the request
+type BinaryDataDescriptor struct {
+	Type     string `json:"type"`
+	OwnerPID uint32 `json:"pid"`
+	Slot     uint32 `json:"slot"`
+}
+
+// Key returns the BlobStore key of the blob, which does not include the owner
+func (binaryDataDescriptor *BinaryDataDescriptor) Key() string {
+	return fmt.Sprintf("%s/%d", binaryDataDescriptor.Type, binaryDataDescriptor.Slot)
+}
+
+// ParseBinaryDataDescriptor decodes and validates RBBinaryData metadata
+func ParseBinaryDataDescriptor(metadata string) (*BinaryDataDescriptor, error) {
+	if len(metadata) > MaxBinaryDataMetadataLength {
+		return nil, errors.New("[ParseBinaryDataDescriptor] Metadata too long")
+	}
+
+	binaryDataDescriptor := &BinaryDataDescriptor{}
+
+	if err := json.Unmarshal([]byte(metadata), binaryDataDescriptor); err != nil {
+		return nil, fmt.Errorf("[ParseBinaryDataDescriptor] Invalid metadata: %w", err)
+	}
+
+	if !binaryDataTypeRegex.MatchString(binaryDataDescriptor.Type) {
+		return nil, errors.New("[ParseBinaryDataDescriptor] Invalid type")
+	}
+
+	return binaryDataDescriptor, nil
+}
@@ -0,0 +1,100 @@
+package nexproto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBinaryDataDescriptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		key      string
+		ownerPID uint32
+		wantErr  bool
+	}{
+		{"full descriptor", `{"type":"band_logo","pid":1234,"slot":2}`, "band_logo/2", 1234, false},
+		{"owner left out", `{"type":"band_logo"}`, "band_logo/0", 0, false},
+		{"unknown fields are ignored", `{"type":"setlist","slot":1,"extra":true}`, "setlist/1", 0, false},
+		{"missing type", `{"pid":1234}`, "", 0, true},
+		{"uppercase type", `{"type":"Band_Logo"}`, "", 0, true},
+		{"type with a path separator", `{"type":"../logo"}`, "", 0, true},
+		{"type too long", `{"type":"` + strings.Repeat("a", 33) + `"}`, "", 0, true},
+		{"negative pid", `{"type":"band_logo","pid":-1}`, "", 0, true},
+		{"not JSON", "band_logo", "", 0, true},
+		{"empty", "", "", 0, true},
+		{"too long", `{"type":"band_logo","pad":"` + strings.Repeat("a", MaxBinaryDataMetadataLength) + `"}`, "", 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			descriptor, err := ParseBinaryDataDescriptor(test.metadata)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", descriptor)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if descriptor.Key() != test.key || descriptor.OwnerPID != test.ownerPID {
+				t.Fatalf("got key %q owner %d, want %q owner %d", descriptor.Key(), descriptor.OwnerPID, test.key, test.ownerPID)
+			}
+		})
+	}
+}
+
+func TestRBBinaryDataAuthorizeDescriptor(t *testing.T) {
+	rbBinaryDataProtocol := &RBBinaryDataProtocol{
+		PublicBinaryDataTypes: map[string]bool{"band_logo": true},
+	}
+
+	tests := []struct {
+		name       string
+		pid        uint32
+		metadata   string
+		write      bool
+		ownerPID   uint32
+		resultCode uint32
+	}{
+		{"write own blob", 1000, `{"type":"setlist","pid":1000}`, true, 1000, ResultCodeSuccess},
+		{"owner defaults to the client", 1000, `{"type":"setlist"}`, true, 1000, ResultCodeSuccess},
+		{"read own private blob", 1000, `{"type":"setlist"}`, false, 1000, ResultCodeSuccess},
+		{"write blob of another player", 1000, `{"type":"setlist","pid":1001}`, true, 0, ResultCodeCoreAccessDenied},
+		{"read private blob of another player", 1000, `{"type":"setlist","pid":1001}`, false, 0, ResultCodeCoreAccessDenied},
+		{"read public blob of another player", 1000, `{"type":"band_logo","pid":1001}`, false, 1001, ResultCodeSuccess},
+		{"write public blob of another player", 1000, `{"type":"band_logo","pid":1001}`, true, 0, ResultCodeCoreAccessDenied},
+		{"invalid metadata", 1000, `{"type":""}`, false, 0, ResultCodeCoreInvalidArgument},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			descriptor, resultCode, err := rbBinaryDataProtocol.authorizeDescriptor(test.pid, test.metadata, test.write)
+
+			if resultCode != test.resultCode {
+				t.Fatalf("got result code %#x, want %#x", resultCode, test.resultCode)
+			}
+
+			if test.resultCode != ResultCodeSuccess {
+				if err == nil || descriptor != nil {
+					t.Fatalf("got %+v, %v, want an error", descriptor, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if descriptor.OwnerPID != test.ownerPID {
+				t.Fatalf("got owner %d, want %d", descriptor.OwnerPID, test.ownerPID)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package nexproto
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+const (
+	// binaryDataQuotaKey is the key the usage of each player is saved under in the store of a BinaryDataQuota
+	binaryDataQuotaKey = "quota"
+
+	// binaryDataQuotaTotalKey is the key the total is saved under, with PID 0, in the store of a BinaryDataQuota
+	binaryDataQuotaTotalKey = "total"
+)
+
+var (
+	// ErrPlayerQuotaExceeded is returned when a blob would take a player over their quota
+	ErrPlayerQuotaExceeded = errors.New("[BinaryDataQuota] Player storage quota exceeded")
+
+	// ErrGlobalQuotaExceeded is returned when a blob would take the server over its quota
+	ErrGlobalQuotaExceeded = errors.New("[BinaryDataQuota] Global storage quota exceeded")
+)
+
+// BinaryDataUsage holds how much RBBinaryData storage is in use
+type BinaryDataUsage struct {
+	Bytes uint64
+	Blobs int
+}
+
+// BinaryDataReservation is a blob accounted for by BinaryDataQuota.Reserve which can still be undone
+type BinaryDataReservation struct {
+	quota      *BinaryDataQuota
+	pid        uint32
+	key        string
+	generation uint64
+	oldBlob    binaryDataQuotaBlob
+	replacing  bool
+}
+
+// Cancel undoes the reservation, e.g. when saving the blob fails, accounting for the blob it replaced again.
+// Nothing is undone if another blob has been accounted for under the same key since. Cancelling a nil reservation does nothing
+func (binaryDataReservation *BinaryDataReservation) Cancel() error {
+	if binaryDataReservation == nil {
+		return nil
+	}
+
+	binaryDataQuota := binaryDataReservation.quota
+
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	player := binaryDataQuota.players[binaryDataReservation.pid]
+
+	if player == nil || player.blobs[binaryDataReservation.key].generation != binaryDataReservation.generation {
+		return nil
+	}
+
+	if binaryDataReservation.replacing {
+		binaryDataQuota.set(player, binaryDataReservation.key, binaryDataReservation.oldBlob)
+	} else {
+		binaryDataQuota.remove(player, binaryDataReservation.key)
+	}
+
+	return binaryDataQuota.save(binaryDataReservation.pid, player)
+}
+
+type binaryDataQuotaBlob struct {
+	size       uint64
+	generation uint64
+}
+
+type binaryDataQuotaPlayer struct {
+	blobs map[string]binaryDataQuotaBlob
+	usage BinaryDataUsage
+}
+
+// BinaryDataQuota limits how much RBBinaryData storage each player and the whole server may use.
+// Usage is kept in a BlobStore when created with NewPersistentBinaryDataQuota, otherwise it is only
+// tracked in memory and Record can be used to account for blobs saved before a restart.
+// Zero limits are not enforced
+type BinaryDataQuota struct {
+	MaxBytesPerPlayer uint64
+	MaxBlobsPerPlayer int
+	MaxTotalBytes     uint64
+
+	mutex      sync.Mutex
+	store      BlobStore
+	players    map[uint32]*binaryDataQuotaPlayer
+	totalBytes uint64
+	generation uint64
+}
+
+// Reserve accounts for a blob of size bytes about to be saved under key, replacing any blob already there.
+// The returned reservation can be cancelled if saving the blob fails
+func (binaryDataQuota *BinaryDataQuota) Reserve(pid uint32, key string, size uint64) (*BinaryDataReservation, error) {
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	player, err := binaryDataQuota.player(pid)
+
+	if err != nil {
+		return nil, err
+	}
+
+	oldBlob, replacing := player.blobs[key]
+
+	newBytes := player.usage.Bytes - oldBlob.size + size
+	newBlobs := player.usage.Blobs
+
+	if !replacing {
+		newBlobs++
+	}
+
+	if binaryDataQuota.MaxBytesPerPlayer > 0 && newBytes > binaryDataQuota.MaxBytesPerPlayer {
+		return nil, ErrPlayerQuotaExceeded
+	}
+
+	if binaryDataQuota.MaxBlobsPerPlayer > 0 && newBlobs > binaryDataQuota.MaxBlobsPerPlayer {
+		return nil, ErrPlayerQuotaExceeded
+	}
+
+	if binaryDataQuota.MaxTotalBytes > 0 && binaryDataQuota.totalBytes-oldBlob.size+size > binaryDataQuota.MaxTotalBytes {
+		return nil, ErrGlobalQuotaExceeded
+	}
+
+	generation := binaryDataQuota.record(player, key, size)
+
+	if err := binaryDataQuota.save(pid, player); err != nil {
+		if replacing {
+			binaryDataQuota.set(player, key, oldBlob)
+		} else {
+			binaryDataQuota.remove(player, key)
+		}
+
+		return nil, err
+	}
+
+	reservation := &BinaryDataReservation{
+		quota:      binaryDataQuota,
+		pid:        pid,
+		key:        key,
+		generation: generation,
+		oldBlob:    oldBlob,
+		replacing:  replacing,
+	}
+
+	return reservation, nil
+}
+
+// Record accounts for a blob of size bytes saved under key without checking any limit
+func (binaryDataQuota *BinaryDataQuota) Record(pid uint32, key string, size uint64) error {
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	player, err := binaryDataQuota.player(pid)
+
+	if err != nil {
+		return err
+	}
+
+	binaryDataQuota.record(player, key, size)
+
+	return binaryDataQuota.save(pid, player)
+}
+
+// Remove stops accounting for the blob saved under key
+func (binaryDataQuota *BinaryDataQuota) Remove(pid uint32, key string) error {
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	player, err := binaryDataQuota.player(pid)
+
+	if err != nil {
+		return err
+	}
+
+	if _, ok := player.blobs[key]; !ok {
+		return nil
+	}
+
+	binaryDataQuota.remove(player, key)
+
+	return binaryDataQuota.save(pid, player)
+}
+
+// Usage returns the storage used by a player
+func (binaryDataQuota *BinaryDataQuota) Usage(pid uint32) (BinaryDataUsage, error) {
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	player, err := binaryDataQuota.player(pid)
+
+	if err != nil {
+		return BinaryDataUsage{}, err
+	}
+
+	return player.usage, nil
+}
+
+// TotalBytes returns the storage used by every player together
+func (binaryDataQuota *BinaryDataQuota) TotalBytes() uint64 {
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	return binaryDataQuota.totalBytes
+}
+
+// Reset forgets the storage used by a player, e.g. after their blobs were deleted
+func (binaryDataQuota *BinaryDataQuota) Reset(pid uint32) error {
+	binaryDataQuota.mutex.Lock()
+	defer binaryDataQuota.mutex.Unlock()
+
+	player, err := binaryDataQuota.player(pid)
+
+	if err != nil {
+		return err
+	}
+
+	for key := range player.blobs {
+		binaryDataQuota.remove(player, key)
+	}
+
+	return binaryDataQuota.save(pid, player)
+}
+
+// player returns the usage of a player, loading it from the store if needed. Must be called with mutex held
+func (binaryDataQuota *BinaryDataQuota) player(pid uint32) (*binaryDataQuotaPlayer, error) {
+	if player, ok := binaryDataQuota.players[pid]; ok {
+		return player, nil
+	}
+
+	player := &binaryDataQuotaPlayer{blobs: make(map[string]binaryDataQuotaBlob)}
+
+	if binaryDataQuota.store != nil {
+		data, err := binaryDataQuota.store.GetBlob(pid, binaryDataQuotaKey)
+
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return nil, err
+		}
+
+		if err == nil {
+			sizes := make(map[string]uint64)
+
+			if err := json.Unmarshal(data, &sizes); err != nil {
+				return nil, err
+			}
+
+			// the total saved in the store already includes these blobs
+			for key, size := range sizes {
+				player.blobs[key] = binaryDataQuotaBlob{size: size}
+				player.usage.Bytes += size
+				player.usage.Blobs++
+			}
+		}
+	}
+
+	binaryDataQuota.players[pid] = player
+
+	return player, nil
+}
+
+// record sets the size of a blob under a new generation, returning it. Must be called with mutex held
+func (binaryDataQuota *BinaryDataQuota) record(player *binaryDataQuotaPlayer, key string, size uint64) uint64 {
+	binaryDataQuota.generation++
+	binaryDataQuota.set(player, key, binaryDataQuotaBlob{size: size, generation: binaryDataQuota.generation})
+
+	return binaryDataQuota.generation
+}
+
+// set sets a blob. Must be called with mutex held
+func (binaryDataQuota *BinaryDataQuota) set(player *binaryDataQuotaPlayer, key string, blob binaryDataQuotaBlob) {
+	binaryDataQuota.remove(player, key)
+
+	player.blobs[key] = blob
+	player.usage.Bytes += blob.size
+	player.usage.Blobs++
+	binaryDataQuota.totalBytes += blob.size
+}
+
+// remove forgets the size of a blob. Must be called with mutex held
+func (binaryDataQuota *BinaryDataQuota) remove(player *binaryDataQuotaPlayer, key string) {
+	blob, ok := player.blobs[key]
+
+	if !ok {
+		return
+	}
+
+	delete(player.blobs, key)
+	player.usage.Bytes -= blob.size
+	player.usage.Blobs--
+	binaryDataQuota.totalBytes -= blob.size
+}
+
+// save writes the usage of a player and the total to the store, if any. Must be called with mutex held
+func (binaryDataQuota *BinaryDataQuota) save(pid uint32, player *binaryDataQuotaPlayer) error {
+	if binaryDataQuota.store == nil {
+		return nil
+	}
+
+	sizes := make(map[string]uint64, len(player.blobs))
+
+	for key, blob := range player.blobs {
+		sizes[key] = blob.size
+	}
+
+	data, err := json.Marshal(sizes)
+
+	if err != nil {
+		return err
+	}
+
+	if err := binaryDataQuota.store.SaveBlob(pid, binaryDataQuotaKey, data); err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(binaryDataQuota.totalBytes)
+
+	if err != nil {
+		return err
+	}
+
+	return binaryDataQuota.store.SaveBlob(0, binaryDataQuotaTotalKey, data)
+}
+
+// NewBinaryDataQuota returns a new BinaryDataQuota with the given limits, tracking usage in memory only
+func NewBinaryDataQuota(maxBytesPerPlayer uint64, maxBlobsPerPlayer int, maxTotalBytes uint64) *BinaryDataQuota {
+	return &BinaryDataQuota{
+		MaxBytesPerPlayer: maxBytesPerPlayer,
+		MaxBlobsPerPlayer: maxBlobsPerPlayer,
+		MaxTotalBytes:     maxTotalBytes,
+		players:           make(map[uint32]*binaryDataQuotaPlayer),
+	}
+}
+
+// NewPersistentBinaryDataQuota returns a new BinaryDataQuota with the given limits, keeping usage in store
+// so it survives restarts. The usage of each player is saved under their PID and the total under PID 0,
+// so store should not be shared with the blobs themselves
+func NewPersistentBinaryDataQuota(store BlobStore, maxBytesPerPlayer uint64, maxBlobsPerPlayer int, maxTotalBytes uint64) (*BinaryDataQuota, error) {
+	binaryDataQuota := NewBinaryDataQuota(maxBytesPerPlayer, maxBlobsPerPlayer, maxTotalBytes)
+	binaryDataQuota.store = store
+
+	data, err := store.GetBlob(0, binaryDataQuotaTotalKey)
+
+	if errors.Is(err, ErrBlobNotFound) {
+		return binaryDataQuota, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &binaryDataQuota.totalBytes); err != nil {
+		return nil, err
+	}
+
+	return binaryDataQuota, nil
+}
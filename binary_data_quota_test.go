@@ -0,0 +1,219 @@
+package nexproto
+
+import (
+	"errors"
+	"testing"
+)
+
+func reserveTestBlob(t *testing.T, binaryDataQuota *BinaryDataQuota, pid uint32, key string, size uint64) *BinaryDataReservation {
+	t.Helper()
+
+	reservation, err := binaryDataQuota.Reserve(pid, key, size)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reservation
+}
+
+func checkBinaryDataUsage(t *testing.T, binaryDataQuota *BinaryDataQuota, pid uint32, want BinaryDataUsage) {
+	t.Helper()
+
+	usage, err := binaryDataQuota.Usage(pid)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage != want {
+		t.Fatalf("got usage %+v for %d, want %+v", usage, pid, want)
+	}
+}
+
+func TestBinaryDataQuotaReserve(t *testing.T) {
+	binaryDataQuota := NewBinaryDataQuota(100, 2, 160)
+
+	steps := []struct {
+		name string
+		pid  uint32
+		key  string
+		size uint64
+		err  error
+	}{
+		{"first blob", 1000, "a", 60, nil},
+		{"over player bytes", 1000, "b", 41, ErrPlayerQuotaExceeded},
+		{"up to player bytes", 1000, "b", 40, nil},
+		{"over player blobs", 1000, "c", 0, ErrPlayerQuotaExceeded},
+		{"replacing does not add a blob", 1000, "b", 10, nil},
+		{"replacing counts only the difference", 1000, "a", 90, nil},
+		{"other player", 1001, "a", 50, nil},
+		{"over global bytes", 1001, "b", 11, ErrGlobalQuotaExceeded},
+		{"up to global bytes", 1001, "b", 10, nil},
+	}
+
+	for _, step := range steps {
+		if _, err := binaryDataQuota.Reserve(step.pid, step.key, step.size); !errors.Is(err, step.err) {
+			t.Fatalf("%s: got %v, want %v", step.name, err, step.err)
+		}
+	}
+
+	checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{Bytes: 100, Blobs: 2})
+	checkBinaryDataUsage(t, binaryDataQuota, 1001, BinaryDataUsage{Bytes: 60, Blobs: 2})
+
+	if totalBytes := binaryDataQuota.TotalBytes(); totalBytes != 160 {
+		t.Fatalf("got %d total bytes, want 160", totalBytes)
+	}
+}
+
+func TestBinaryDataReservationCancel(t *testing.T) {
+	t.Run("new blob", func(t *testing.T) {
+		binaryDataQuota := NewBinaryDataQuota(0, 0, 0)
+		reservation := reserveTestBlob(t, binaryDataQuota, 1000, "a", 10)
+
+		if err := reservation.Cancel(); err != nil {
+			t.Fatal(err)
+		}
+
+		checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{})
+	})
+
+	t.Run("replaced blob is accounted for again", func(t *testing.T) {
+		binaryDataQuota := NewBinaryDataQuota(0, 0, 0)
+		reserveTestBlob(t, binaryDataQuota, 1000, "a", 10)
+		reservation := reserveTestBlob(t, binaryDataQuota, 1000, "a", 30)
+
+		if err := reservation.Cancel(); err != nil {
+			t.Fatal(err)
+		}
+
+		checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{Bytes: 10, Blobs: 1})
+
+		if totalBytes := binaryDataQuota.TotalBytes(); totalBytes != 10 {
+			t.Fatalf("got %d total bytes, want 10", totalBytes)
+		}
+	})
+
+	t.Run("later reservation is kept", func(t *testing.T) {
+		binaryDataQuota := NewBinaryDataQuota(0, 0, 0)
+		reservation := reserveTestBlob(t, binaryDataQuota, 1000, "a", 10)
+		reserveTestBlob(t, binaryDataQuota, 1000, "a", 20)
+
+		if err := reservation.Cancel(); err != nil {
+			t.Fatal(err)
+		}
+
+		checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{Bytes: 20, Blobs: 1})
+	})
+
+	t.Run("cancelling twice", func(t *testing.T) {
+		binaryDataQuota := NewBinaryDataQuota(0, 0, 0)
+		reserveTestBlob(t, binaryDataQuota, 1000, "a", 10)
+		reservation := reserveTestBlob(t, binaryDataQuota, 1000, "a", 30)
+
+		for i := 0; i < 2; i++ {
+			if err := reservation.Cancel(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{Bytes: 10, Blobs: 1})
+	})
+
+	t.Run("nil reservation", func(t *testing.T) {
+		var reservation *BinaryDataReservation
+
+		if err := reservation.Cancel(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestBinaryDataQuotaRecordRemoveReset(t *testing.T) {
+	binaryDataQuota := NewBinaryDataQuota(10, 1, 0)
+
+	// Record accounts for blobs saved before a restart, even over the limits
+	for _, key := range []string{"a", "b"} {
+		if err := binaryDataQuota.Record(1000, key, 20); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{Bytes: 40, Blobs: 2})
+
+	if err := binaryDataQuota.Remove(1000, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := binaryDataQuota.Remove(1000, "missing"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{Bytes: 20, Blobs: 1})
+
+	if err := binaryDataQuota.Reset(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	checkBinaryDataUsage(t, binaryDataQuota, 1000, BinaryDataUsage{})
+
+	if totalBytes := binaryDataQuota.TotalBytes(); totalBytes != 0 {
+		t.Fatalf("got %d total bytes, want 0", totalBytes)
+	}
+}
+
+func TestPersistentBinaryDataQuota(t *testing.T) {
+	store := NewMemoryBlobStore()
+
+	binaryDataQuota, err := NewPersistentBinaryDataQuota(store, 100, 0, 150)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reserveTestBlob(t, binaryDataQuota, 1000, "a", 60)
+	reserveTestBlob(t, binaryDataQuota, 1000, "b", 20)
+	reserveTestBlob(t, binaryDataQuota, 1001, "a", 50)
+
+	if err := reserveTestBlob(t, binaryDataQuota, 1001, "b", 5).Cancel(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := binaryDataQuota.Remove(1000, "b"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewPersistentBinaryDataQuota(store, 100, 0, 150)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if totalBytes := reloaded.TotalBytes(); totalBytes != 110 {
+		t.Fatalf("got %d total bytes after reloading, want 110", totalBytes)
+	}
+
+	checkBinaryDataUsage(t, reloaded, 1000, BinaryDataUsage{Bytes: 60, Blobs: 1})
+	checkBinaryDataUsage(t, reloaded, 1001, BinaryDataUsage{Bytes: 50, Blobs: 1})
+
+	// loading a player must not count their blobs in the total a second time
+	if totalBytes := reloaded.TotalBytes(); totalBytes != 110 {
+		t.Fatalf("got %d total bytes after loading players, want 110", totalBytes)
+	}
+
+	// the limits still apply to the reloaded usage
+	if _, err := reloaded.Reserve(1000, "b", 41); !errors.Is(err, ErrPlayerQuotaExceeded) {
+		t.Fatalf("got %v, want ErrPlayerQuotaExceeded", err)
+	}
+
+	if _, err := reloaded.Reserve(1002, "a", 41); !errors.Is(err, ErrGlobalQuotaExceeded) {
+		t.Fatalf("got %v, want ErrGlobalQuotaExceeded", err)
+	}
+
+	// replacing a reloaded blob only counts the difference
+	reserveTestBlob(t, reloaded, 1000, "a", 100)
+
+	if totalBytes := reloaded.TotalBytes(); totalBytes != 150 {
+		t.Fatalf("got %d total bytes, want 150", totalBytes)
+	}
+}
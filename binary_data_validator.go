@@ -0,0 +1,115 @@
+package nexproto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // register GIF for image.DecodeConfig
+	_ "image/jpeg" // register JPEG for image.DecodeConfig
+	_ "image/png"  // register PNG for image.DecodeConfig
+)
+
+// BinaryDataValidator checks an uploaded blob before the default SaveBinaryData handler saves it.
+// Blobs are served to other consoles, so anything the game could choke on should be rejected
+type BinaryDataValidator interface {
+	ValidateBinaryData(descriptor *BinaryDataDescriptor, blob []byte) error
+}
+
+// BinaryDataValidatorFunc adapts a function to a BinaryDataValidator
+type BinaryDataValidatorFunc func(descriptor *BinaryDataDescriptor, blob []byte) error
+
+// ValidateBinaryData calls the function
+func (binaryDataValidatorFunc BinaryDataValidatorFunc) ValidateBinaryData(descriptor *BinaryDataDescriptor, blob []byte) error {
+	return binaryDataValidatorFunc(descriptor, blob)
+}
+
+// BinaryDataRule describes the blobs accepted for one descriptor type.
+// Zero values disable a check
+type BinaryDataRule struct {
+	MaxSize      int
+	Magic        [][]byte // the blob must start with one of these
+	Image        bool     // the blob must be a PNG, JPEG or GIF image
+	ImageFormats []string // image formats accepted, as named by image.DecodeConfig
+	MaxWidth     int
+	MaxHeight    int
+}
+
+// BinaryDataRuleValidator is a BinaryDataValidator which checks blobs against the BinaryDataRule of their type.
+// Blobs of types without a rule are rejected unless AllowUnknownTypes is set
+type BinaryDataRuleValidator struct {
+	Rules             map[string]*BinaryDataRule
+	AllowUnknownTypes bool
+}
+
+// ValidateBinaryData checks a blob against the rule for its type
+func (binaryDataRuleValidator *BinaryDataRuleValidator) ValidateBinaryData(descriptor *BinaryDataDescriptor, blob []byte) error {
+	rule, ok := binaryDataRuleValidator.Rules[descriptor.Type]
+
+	if !ok {
+		if binaryDataRuleValidator.AllowUnknownTypes {
+			return nil
+		}
+
+		return fmt.Errorf("[BinaryDataRuleValidator] No rule for type %s", descriptor.Type)
+	}
+
+	if rule.MaxSize > 0 && len(blob) > rule.MaxSize {
+		return fmt.Errorf("[BinaryDataRuleValidator] %s is %d bytes, more than %d", descriptor.Type, len(blob), rule.MaxSize)
+	}
+
+	if len(rule.Magic) > 0 && !hasMagic(blob, rule.Magic) {
+		return fmt.Errorf("[BinaryDataRuleValidator] %s does not start with an expected magic", descriptor.Type)
+	}
+
+	if !rule.Image {
+		return nil
+	}
+
+	imageConfig, format, err := image.DecodeConfig(bytes.NewReader(blob))
+
+	if err != nil {
+		return fmt.Errorf("[BinaryDataRuleValidator] %s is not a valid image: %w", descriptor.Type, err)
+	}
+
+	if len(rule.ImageFormats) > 0 && !containsString(rule.ImageFormats, format) {
+		return fmt.Errorf("[BinaryDataRuleValidator] %s image format %s is not allowed", descriptor.Type, format)
+	}
+
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 {
+		return errors.New("[BinaryDataRuleValidator] Image has no pixels")
+	}
+
+	if (rule.MaxWidth > 0 && imageConfig.Width > rule.MaxWidth) || (rule.MaxHeight > 0 && imageConfig.Height > rule.MaxHeight) {
+		return fmt.Errorf("[BinaryDataRuleValidator] %s image is %dx%d, larger than %dx%d", descriptor.Type, imageConfig.Width, imageConfig.Height, rule.MaxWidth, rule.MaxHeight)
+	}
+
+	return nil
+}
+
+// NewBinaryDataRuleValidator returns a new BinaryDataRuleValidator without any rules
+func NewBinaryDataRuleValidator() *BinaryDataRuleValidator {
+	return &BinaryDataRuleValidator{
+		Rules: make(map[string]*BinaryDataRule),
+	}
+}
+
+func hasMagic(blob []byte, magics [][]byte) bool {
+	for _, magic := range magics {
+		if bytes.HasPrefix(blob, magic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
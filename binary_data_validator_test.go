@@ -0,0 +1,93 @@
+package nexproto
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func encodeTestImage(t *testing.T, format string, width int, height int) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	var err error
+
+	switch format {
+	case "png":
+		err = png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, width, height)))
+	case "gif":
+		err = gif.Encode(&buffer, image.NewPaletted(image.Rect(0, 0, width, height), []color.Color{color.Black}), nil)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestBinaryDataRuleValidator(t *testing.T) {
+	logoPNG := encodeTestImage(t, "png", 64, 32)
+
+	binaryDataRuleValidator := NewBinaryDataRuleValidator()
+	binaryDataRuleValidator.Rules["setlist"] = &BinaryDataRule{
+		MaxSize: 8,
+		Magic:   [][]byte{[]byte("SL1"), []byte("SL2")},
+	}
+	binaryDataRuleValidator.Rules["band_logo"] = &BinaryDataRule{
+		Image:        true,
+		ImageFormats: []string{"png"},
+		MaxWidth:     64,
+		MaxHeight:    64,
+	}
+	binaryDataRuleValidator.Rules["any_image"] = &BinaryDataRule{
+		Image: true,
+	}
+
+	tests := []struct {
+		name     string
+		typeName string
+		blob     []byte
+		wantErr  bool
+	}{
+		{"first magic", "setlist", []byte("SL1data"), false},
+		{"second magic", "setlist", []byte("SL2"), false},
+		{"wrong magic", "setlist", []byte("XX1data"), true},
+		{"shorter than the magic", "setlist", []byte("SL"), true},
+		{"at MaxSize", "setlist", []byte("SL1aaaaa"), false},
+		{"over MaxSize", "setlist", []byte("SL1aaaaaa"), true},
+		{"image within bounds", "band_logo", logoPNG, false},
+		{"image at the bounds", "band_logo", encodeTestImage(t, "png", 64, 64), false},
+		{"image too wide", "band_logo", encodeTestImage(t, "png", 65, 1), true},
+		{"image too tall", "band_logo", encodeTestImage(t, "png", 1, 65), true},
+		{"image format not allowed", "band_logo", encodeTestImage(t, "gif", 8, 8), true},
+		{"any image format", "any_image", encodeTestImage(t, "gif", 8, 8), false},
+		{"not an image", "band_logo", []byte("definitely not a png"), true},
+		{"truncated image", "band_logo", logoPNG[:16], true},
+		{"empty image", "any_image", nil, true},
+		{"type without a rule", "unknown", []byte("data"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := binaryDataRuleValidator.ValidateBinaryData(&BinaryDataDescriptor{Type: test.typeName}, test.blob)
+
+			if test.wantErr && err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !test.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+
+	binaryDataRuleValidator.AllowUnknownTypes = true
+
+	if err := binaryDataRuleValidator.ValidateBinaryData(&BinaryDataDescriptor{Type: "unknown"}, []byte("data")); err != nil {
+		t.Fatalf("got %v with AllowUnknownTypes, want no error", err)
+	}
+}
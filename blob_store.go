@@ -0,0 +1,133 @@
+package nexproto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// ErrBlobNotFound is returned by a BlobStore when no blob is stored under a key
+var ErrBlobNotFound = errors.New("[BlobStore] Blob not found")
+
+// BlobStore stores the blobs uploaded through the RBBinaryData protocol.
+// Blobs are keyed by the PID of their owner and a metadata key
+type BlobStore interface {
+	SaveBlob(pid uint32, key string, blob []byte) error
+	GetBlob(pid uint32, key string) ([]byte, error)
+	DeleteBlob(pid uint32, key string) error
+}
+
+type blobKey struct {
+	pid uint32
+	key string
+}
+
+// MemoryBlobStore is a BlobStore which keeps blobs in memory
+type MemoryBlobStore struct {
+	mutex sync.RWMutex
+	blobs map[blobKey][]byte
+}
+
+// SaveBlob stores a blob, replacing any blob already stored under the same key
+func (memoryBlobStore *MemoryBlobStore) SaveBlob(pid uint32, key string, blob []byte) error {
+	memoryBlobStore.mutex.Lock()
+	defer memoryBlobStore.mutex.Unlock()
+
+	memoryBlobStore.blobs[blobKey{pid, key}] = append([]byte(nil), blob...)
+
+	return nil
+}
+
+// GetBlob returns the blob stored under a key
+func (memoryBlobStore *MemoryBlobStore) GetBlob(pid uint32, key string) ([]byte, error) {
+	memoryBlobStore.mutex.RLock()
+	defer memoryBlobStore.mutex.RUnlock()
+
+	blob, ok := memoryBlobStore.blobs[blobKey{pid, key}]
+
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+
+	return append([]byte(nil), blob...), nil
+}
+
+// DeleteBlob removes the blob stored under a key
+func (memoryBlobStore *MemoryBlobStore) DeleteBlob(pid uint32, key string) error {
+	memoryBlobStore.mutex.Lock()
+	defer memoryBlobStore.mutex.Unlock()
+
+	if _, ok := memoryBlobStore.blobs[blobKey{pid, key}]; !ok {
+		return ErrBlobNotFound
+	}
+
+	delete(memoryBlobStore.blobs, blobKey{pid, key})
+
+	return nil
+}
+
+// NewMemoryBlobStore returns a new MemoryBlobStore
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{
+		blobs: make(map[blobKey][]byte),
+	}
+}
+
+// FileBlobStore is a BlobStore which keeps every blob in its own file under a directory.
+// Blobs are written to a temporary file and renamed into place, so a crash never leaves a partial blob behind
+type FileBlobStore struct {
+	directory string
+}
+
+// SaveBlob stores a blob, replacing any blob already stored under the same key
+func (fileBlobStore *FileBlobStore) SaveBlob(pid uint32, key string, blob []byte) error {
+	path := fileBlobStore.path(pid, key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, blob)
+}
+
+// GetBlob returns the blob stored under a key
+func (fileBlobStore *FileBlobStore) GetBlob(pid uint32, key string) ([]byte, error) {
+	blob, err := os.ReadFile(fileBlobStore.path(pid, key))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBlobNotFound
+	}
+
+	return blob, err
+}
+
+// DeleteBlob removes the blob stored under a key
+func (fileBlobStore *FileBlobStore) DeleteBlob(pid uint32, key string) error {
+	err := os.Remove(fileBlobStore.path(pid, key))
+
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrBlobNotFound
+	}
+
+	return err
+}
+
+// path returns the file a blob is stored in. Keys are hashed so clients can't pick the file name or its length
+func (fileBlobStore *FileBlobStore) path(pid uint32, key string) string {
+	keyHash := sha256.Sum256([]byte(key))
+
+	return filepath.Join(fileBlobStore.directory, strconv.FormatUint(uint64(pid), 10), hex.EncodeToString(keyHash[:]))
+}
+
+// NewFileBlobStore returns a new FileBlobStore which stores blobs under directory, creating it if needed
+func NewFileBlobStore(directory string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileBlobStore{directory: directory}, nil
+}
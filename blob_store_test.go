@@ -0,0 +1,138 @@
+package nexproto
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestBlobStores(t *testing.T) map[string]BlobStore {
+	t.Helper()
+
+	fileBlobStore, err := NewFileBlobStore(filepath.Join(t.TempDir(), "blobs"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]BlobStore{
+		"memory": NewMemoryBlobStore(),
+		"file":   fileBlobStore,
+	}
+}
+
+func TestBlobStore(t *testing.T) {
+	for name, blobStore := range newTestBlobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			steps := []struct {
+				name      string
+				operation string
+				pid       uint32
+				key       string
+				blob      []byte
+				want      []byte
+				err       error
+			}{
+				{"missing blob", "get", 1000, "band_logo/0", nil, nil, ErrBlobNotFound},
+				{"save", "save", 1000, "band_logo/0", []byte("first"), nil, nil},
+				{"get saved", "get", 1000, "band_logo/0", nil, []byte("first"), nil},
+				{"overwrite", "save", 1000, "band_logo/0", []byte("second"), nil, nil},
+				{"get overwritten", "get", 1000, "band_logo/0", nil, []byte("second"), nil},
+				{"same key of another player", "get", 1001, "band_logo/0", nil, nil, ErrBlobNotFound},
+				{"other key of same player", "get", 1000, "band_logo/1", nil, nil, ErrBlobNotFound},
+				{"key with path separators", "save", 1000, "../../escape", []byte("contained"), nil, nil},
+				{"get key with path separators", "get", 1000, "../../escape", nil, []byte("contained"), nil},
+				{"empty blob", "save", 1000, "empty", []byte{}, nil, nil},
+				{"get empty blob", "get", 1000, "empty", nil, []byte{}, nil},
+				{"delete", "delete", 1000, "band_logo/0", nil, nil, nil},
+				{"get deleted", "get", 1000, "band_logo/0", nil, nil, ErrBlobNotFound},
+				{"delete again", "delete", 1000, "band_logo/0", nil, nil, ErrBlobNotFound},
+			}
+
+			for _, step := range steps {
+				var blob []byte
+				var err error
+
+				switch step.operation {
+				case "save":
+					err = blobStore.SaveBlob(step.pid, step.key, step.blob)
+				case "get":
+					blob, err = blobStore.GetBlob(step.pid, step.key)
+				case "delete":
+					err = blobStore.DeleteBlob(step.pid, step.key)
+				}
+
+				if !errors.Is(err, step.err) {
+					t.Fatalf("%s: got %v, want %v", step.name, err, step.err)
+				}
+
+				if step.operation == "get" && step.err == nil && !bytes.Equal(blob, step.want) {
+					t.Fatalf("%s: got %q, want %q", step.name, blob, step.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBlobStoreCopiesBlobs(t *testing.T) {
+	for name, blobStore := range newTestBlobStores(t) {
+		t.Run(name, func(t *testing.T) {
+			blob := []byte("original")
+
+			if err := blobStore.SaveBlob(1000, "key", blob); err != nil {
+				t.Fatal(err)
+			}
+
+			blob[0] = 'X'
+
+			stored, err := blobStore.GetBlob(1000, "key")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stored[1] = 'X'
+
+			if stored, err := blobStore.GetBlob(1000, "key"); err != nil || string(stored) != "original" {
+				t.Fatalf("got %q, %v, want the stored blob to be unchanged", stored, err)
+			}
+		})
+	}
+}
+
+func TestFileBlobStoreLayout(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "blobs")
+	fileBlobStore, err := NewFileBlobStore(directory)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fileBlobStore.SaveBlob(1000, "../../escape", []byte("blob")); err != nil {
+		t.Fatal(err)
+	}
+
+	// every blob lives in the directory of its owner, whatever its key
+	entries, err := os.ReadDir(filepath.Join(directory, "1000"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 1 || len(entries[0].Name()) != 64 {
+		t.Fatalf("unexpected files %v", entries)
+	}
+
+	// a second store on the same directory sees the same blobs, as after a restart
+	reopened, err := NewFileBlobStore(directory)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if blob, err := reopened.GetBlob(1000, "../../escape"); err != nil || string(blob) != "blob" {
+		t.Fatalf("got %q, %v after reopening", blob, err)
+	}
+}
@@ -0,0 +1,115 @@
+package nexproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrKerberosTicketExpired is returned when a CONNECT payload carries an expired ticket
+var ErrKerberosTicketExpired = errors.New("[VerifyConnectPayload] Ticket has expired")
+
+// ConnectPIDMismatchError is returned when the PID inside the ticket does not match the PID of the request
+type ConnectPIDMismatchError struct {
+	TicketPID  uint32
+	RequestPID uint32
+}
+
+func (connectPIDMismatchError *ConnectPIDMismatchError) Error() string {
+	return fmt.Sprintf("[VerifyConnectPayload] Ticket PID %d does not match request PID %d", connectPIDMismatchError.TicketPID, connectPIDMismatchError.RequestPID)
+}
+
+// ConnectData holds the verified contents of a Secure server PRUDP CONNECT payload
+type ConnectData struct {
+	UserPID       uint32
+	CID           uint32 // CID of the secure server station URL
+	ResponseCheck uint32
+	SessionKey    []byte
+	Expiration    time.Time
+}
+
+// AcknowledgePayload returns the payload to acknowledge the CONNECT packet with
+func (connectData *ConnectData) AcknowledgePayload() []byte {
+	payload := make([]byte, 8)
+
+	binary.LittleEndian.PutUint32(payload[0:4], 4)
+	binary.LittleEndian.PutUint32(payload[4:8], connectData.ResponseCheck+1)
+
+	return payload
+}
+
+// VerifyConnectPayload decrypts the ticket and request data of a CONNECT payload and checks them against each other.
+// serverKey is the Kerberos key of the secure server the ticket was issued for.
+//
+// On success the caller should update the client RC4 key with the session key and acknowledge the packet:
+//
+//	connectData, err := nexproto.VerifyConnectPayload(packet.Payload(), serverKey, 16)
+//	packet.Sender().UpdateRC4Key(connectData.SessionKey)
+//	nexServer.AcknowledgePacket(packet, connectData.AcknowledgePayload())
+func VerifyConnectPayload(payload []byte, serverKey []byte, keySize int) (*ConnectData, error) {
+	ticketData, payload, err := readConnectBuffer(payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	requestData, _, err := readConnectBuffer(payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	internalData, err := DecryptKerberosTicketInternalData(ticketData, serverKey, keySize)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if internalData.Expired(time.Now()) {
+		return nil, ErrKerberosTicketExpired
+	}
+
+	decryptedRequestData, err := kerberosDecrypt(internalData.SessionKey, requestData)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decryptedRequestData) < 12 {
+		return nil, errors.New("[VerifyConnectPayload] Request data size too small")
+	}
+
+	requestPID := binary.LittleEndian.Uint32(decryptedRequestData[0:4])
+
+	if requestPID != internalData.UserPID {
+		return nil, &ConnectPIDMismatchError{
+			TicketPID:  internalData.UserPID,
+			RequestPID: requestPID,
+		}
+	}
+
+	connectData := &ConnectData{
+		UserPID:       requestPID,
+		CID:           binary.LittleEndian.Uint32(decryptedRequestData[4:8]),
+		ResponseCheck: binary.LittleEndian.Uint32(decryptedRequestData[8:12]),
+		SessionKey:    internalData.SessionKey,
+		Expiration:    internalData.Expiration,
+	}
+
+	return connectData, nil
+}
+
+func readConnectBuffer(data []byte) ([]byte, []byte, error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("[VerifyConnectPayload] Buffer missing length")
+	}
+
+	length := binary.LittleEndian.Uint32(data[0:4])
+
+	if uint32(len(data)-4) < length {
+		return nil, nil, errors.New("[VerifyConnectPayload] Buffer length too large")
+	}
+
+	return data[4 : 4+length], data[4+length:], nil
+}
@@ -0,0 +1,113 @@
+package nexproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// buildConnectPayload builds a CONNECT payload the way a client would from a ticket
+func buildConnectPayload(t *testing.T, serverKey []byte, ticketPID uint32, requestPID uint32, expiration time.Time) ([]byte, []byte) {
+	t.Helper()
+
+	sessionKey := bytes.Repeat([]byte{0x42}, 16)
+
+	internalData := &KerberosTicketInternalData{
+		Expiration: expiration,
+		UserPID:    ticketPID,
+		SessionKey: sessionKey,
+	}
+
+	ticketData, err := internalData.Encrypt(serverKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestData := make([]byte, 12)
+	binary.LittleEndian.PutUint32(requestData[0:4], requestPID)
+	binary.LittleEndian.PutUint32(requestData[4:8], 7)
+	binary.LittleEndian.PutUint32(requestData[8:12], 100)
+
+	requestData, err = kerberosEncrypt(sessionKey, requestData)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := binary.LittleEndian.AppendUint32(nil, uint32(len(ticketData)))
+	payload = append(payload, ticketData...)
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(requestData)))
+	payload = append(payload, requestData...)
+
+	return payload, sessionKey
+}
+
+func TestVerifyConnectPayload(t *testing.T) {
+	serverKey := DeriveKerberosKey(2, []byte("secure server password"))
+	validPayload, sessionKey := buildConnectPayload(t, serverKey, 1234, 1234, time.Now().Add(time.Hour))
+	expiredPayload, _ := buildConnectPayload(t, serverKey, 1234, 1234, time.Now().Add(-time.Hour))
+	mismatchPayload, _ := buildConnectPayload(t, serverKey, 1234, 5678, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		serverKey []byte
+		check     func(t *testing.T, connectData *ConnectData, err error)
+	}{
+		{"valid ticket", validPayload, serverKey, func(t *testing.T, connectData *ConnectData, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if connectData.UserPID != 1234 || connectData.CID != 7 || connectData.ResponseCheck != 100 {
+				t.Fatalf("unexpected connect data %+v", connectData)
+			}
+
+			if !bytes.Equal(connectData.SessionKey, sessionKey) {
+				t.Fatalf("got session key %x, want %x", connectData.SessionKey, sessionKey)
+			}
+
+			if binary.LittleEndian.Uint32(connectData.AcknowledgePayload()[4:8]) != 101 {
+				t.Fatal("acknowledge payload does not hold response check + 1")
+			}
+		}},
+		{"expired ticket", expiredPayload, serverKey, func(t *testing.T, connectData *ConnectData, err error) {
+			if !errors.Is(err, ErrKerberosTicketExpired) {
+				t.Fatalf("got %v, want ErrKerberosTicketExpired", err)
+			}
+		}},
+		{"PID mismatch", mismatchPayload, serverKey, func(t *testing.T, connectData *ConnectData, err error) {
+			var mismatchErr *ConnectPIDMismatchError
+
+			if !errors.As(err, &mismatchErr) {
+				t.Fatalf("got %v, want ConnectPIDMismatchError", err)
+			}
+
+			if mismatchErr.TicketPID != 1234 || mismatchErr.RequestPID != 5678 {
+				t.Fatalf("unexpected mismatch %+v", mismatchErr)
+			}
+		}},
+		{"wrong server key", validPayload, []byte("other key"), expectConnectError},
+		{"empty payload", nil, serverKey, expectConnectError},
+		{"truncated ticket length", validPayload[:2], serverKey, expectConnectError},
+		{"truncated ticket", validPayload[:20], serverKey, expectConnectError},
+		{"missing request data", validPayload[:4+binary.LittleEndian.Uint32(validPayload)], serverKey, expectConnectError},
+		{"truncated request data", validPayload[:len(validPayload)-1], serverKey, expectConnectError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			connectData, err := VerifyConnectPayload(test.payload, test.serverKey, 16)
+			test.check(t, connectData, err)
+		})
+	}
+}
+
+func expectConnectError(t *testing.T, connectData *ConnectData, err error) {
+	if err == nil {
+		t.Fatalf("expected an error, got %+v", connectData)
+	}
+}
@@ -0,0 +1,350 @@
+package nexproto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	// contentAddressedPlayersKey is the key the PIDs with an index are saved under
+	contentAddressedPlayersKey = "players"
+
+	// contentAddressedIndexPrefix prefixes the key the index of each player is saved under
+	contentAddressedIndexPrefix = "index/"
+
+	// contentAddressedBlobPrefix prefixes the key every distinct blob is saved under
+	contentAddressedBlobPrefix = "sha256/"
+)
+
+// ErrReservedBlobPID is returned by a ContentAddressedBlobStore for PID 0, which it keeps for itself
+var ErrReservedBlobPID = errors.New("[ContentAddressedBlobStore] PID 0 is reserved")
+
+// contentAddressedIndex holds the references of one player, and the hashes which lost their last
+// reference through that player and may have to be collected
+type contentAddressedIndex struct {
+	References map[string]string `json:"references"`
+	Released   []string          `json:"released,omitempty"`
+}
+
+// ContentAddressedBlobStore is a BlobStore which saves every distinct blob only once.
+// Blobs are saved in a backing BlobStore under PID 0 and the hex SHA-256 of their content,
+// next to an index per player mapping each of their keys to a hash, so a save only rewrites
+// the index of the player saving. Blobs which lose their last reference, or which a crash kept
+// the index from referring to, stay in the backing store until CollectGarbage is called
+type ContentAddressedBlobStore struct {
+	backend   BlobStore
+	mutex     sync.Mutex
+	indexes   map[uint32]*contentAddressedIndex
+	refCounts map[string]int
+}
+
+// SaveBlob stores a blob, replacing any blob already stored under the same key
+func (contentAddressedBlobStore *ContentAddressedBlobStore) SaveBlob(pid uint32, key string, blob []byte) error {
+	if pid == 0 {
+		return ErrReservedBlobPID
+	}
+
+	contentAddressedBlobStore.mutex.Lock()
+	defer contentAddressedBlobStore.mutex.Unlock()
+
+	hash := HashBlob(blob)
+
+	index, err := contentAddressedBlobStore.playerIndex(pid)
+
+	if err != nil {
+		return err
+	}
+
+	// blobs without a reference may already have been collected, or never have been written before a crash
+	if contentAddressedBlobStore.refCounts[hash] <= 0 {
+		// the hash is released before the blob is written, so the blob is collected if a crash keeps the index from referring to it
+		if !containsString(index.Released, hash) {
+			index.Released = append(index.Released, hash)
+
+			if err := contentAddressedBlobStore.saveIndex(pid, index); err != nil {
+				return err
+			}
+		}
+
+		if err := contentAddressedBlobStore.backend.SaveBlob(0, contentAddressedBlobPrefix+hash, blob); err != nil {
+			return err
+		}
+	}
+
+	if oldHash, ok := index.References[key]; ok {
+		contentAddressedBlobStore.release(index, oldHash)
+	}
+
+	index.References[key] = hash
+	index.Released = removeString(index.Released, hash)
+	contentAddressedBlobStore.refCounts[hash]++
+
+	return contentAddressedBlobStore.saveIndex(pid, index)
+}
+
+// GetBlob returns the blob stored under a key
+func (contentAddressedBlobStore *ContentAddressedBlobStore) GetBlob(pid uint32, key string) ([]byte, error) {
+	hash, err := contentAddressedBlobStore.Hash(pid, key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := contentAddressedBlobStore.backend.GetBlob(0, contentAddressedBlobPrefix+hash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if HashBlob(blob) != hash {
+		return nil, errors.New("[ContentAddressedBlobStore] Stored blob does not match its hash")
+	}
+
+	return blob, nil
+}
+
+// DeleteBlob removes the blob stored under a key
+func (contentAddressedBlobStore *ContentAddressedBlobStore) DeleteBlob(pid uint32, key string) error {
+	if pid == 0 {
+		return ErrReservedBlobPID
+	}
+
+	contentAddressedBlobStore.mutex.Lock()
+	defer contentAddressedBlobStore.mutex.Unlock()
+
+	index, ok := contentAddressedBlobStore.indexes[pid]
+
+	if !ok {
+		return ErrBlobNotFound
+	}
+
+	hash, ok := index.References[key]
+
+	if !ok {
+		return ErrBlobNotFound
+	}
+
+	delete(index.References, key)
+	contentAddressedBlobStore.release(index, hash)
+
+	return contentAddressedBlobStore.saveIndex(pid, index)
+}
+
+// Hash returns the hex SHA-256 of the blob stored under a key, which can be used as a cache key or ETag
+func (contentAddressedBlobStore *ContentAddressedBlobStore) Hash(pid uint32, key string) (string, error) {
+	contentAddressedBlobStore.mutex.Lock()
+	defer contentAddressedBlobStore.mutex.Unlock()
+
+	index, ok := contentAddressedBlobStore.indexes[pid]
+
+	if !ok {
+		return "", ErrBlobNotFound
+	}
+
+	hash, ok := index.References[key]
+
+	if !ok {
+		return "", ErrBlobNotFound
+	}
+
+	return hash, nil
+}
+
+// ReferenceCount returns how many keys refer to the blob with the given hash
+func (contentAddressedBlobStore *ContentAddressedBlobStore) ReferenceCount(hash string) int {
+	contentAddressedBlobStore.mutex.Lock()
+	defer contentAddressedBlobStore.mutex.Unlock()
+
+	return contentAddressedBlobStore.refCounts[hash]
+}
+
+// CollectGarbage deletes every blob no key refers to anymore, returning how many were deleted
+func (contentAddressedBlobStore *ContentAddressedBlobStore) CollectGarbage() (int, error) {
+	contentAddressedBlobStore.mutex.Lock()
+	defer contentAddressedBlobStore.mutex.Unlock()
+
+	deleted := 0
+
+	for hash, refCount := range contentAddressedBlobStore.refCounts {
+		if refCount > 0 {
+			continue
+		}
+
+		err := contentAddressedBlobStore.backend.DeleteBlob(0, contentAddressedBlobPrefix+hash)
+
+		if err != nil && !errors.Is(err, ErrBlobNotFound) {
+			return deleted, err
+		}
+
+		delete(contentAddressedBlobStore.refCounts, hash)
+		deleted++
+	}
+
+	// forget released hashes which were collected or are referenced again
+	for pid, index := range contentAddressedBlobStore.indexes {
+		if len(index.Released) == 0 {
+			continue
+		}
+
+		index.Released = nil
+
+		if err := contentAddressedBlobStore.saveIndex(pid, index); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// playerIndex returns the index of a player, creating it if needed. Must be called with mutex held
+func (contentAddressedBlobStore *ContentAddressedBlobStore) playerIndex(pid uint32) (*contentAddressedIndex, error) {
+	if index, ok := contentAddressedBlobStore.indexes[pid]; ok {
+		return index, nil
+	}
+
+	index := &contentAddressedIndex{References: make(map[string]string)}
+	contentAddressedBlobStore.indexes[pid] = index
+
+	// the list of players only changes when a player saves their first blob
+	if err := contentAddressedBlobStore.savePlayers(); err != nil {
+		delete(contentAddressedBlobStore.indexes, pid)
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// release drops a reference to a hash, remembering it in the index if it was the last one. Must be called with mutex held
+func (contentAddressedBlobStore *ContentAddressedBlobStore) release(index *contentAddressedIndex, hash string) {
+	contentAddressedBlobStore.refCounts[hash]--
+
+	if contentAddressedBlobStore.refCounts[hash] <= 0 {
+		index.Released = append(index.Released, hash)
+	}
+}
+
+// saveIndex writes the index of a player to the backing store. Must be called with mutex held
+func (contentAddressedBlobStore *ContentAddressedBlobStore) saveIndex(pid uint32, index *contentAddressedIndex) error {
+	data, err := json.Marshal(index)
+
+	if err != nil {
+		return err
+	}
+
+	return contentAddressedBlobStore.backend.SaveBlob(0, contentAddressedIndexPrefix+strconv.FormatUint(uint64(pid), 10), data)
+}
+
+// savePlayers writes the PIDs with an index to the backing store. Must be called with mutex held
+func (contentAddressedBlobStore *ContentAddressedBlobStore) savePlayers() error {
+	pids := make([]uint32, 0, len(contentAddressedBlobStore.indexes))
+
+	for pid := range contentAddressedBlobStore.indexes {
+		pids = append(pids, pid)
+	}
+
+	sort.Slice(pids, func(i, j int) bool {
+		return pids[i] < pids[j]
+	})
+
+	data, err := json.Marshal(pids)
+
+	if err != nil {
+		return err
+	}
+
+	return contentAddressedBlobStore.backend.SaveBlob(0, contentAddressedPlayersKey, data)
+}
+
+// removeString returns list without any occurrence of value
+func removeString(list []string, value string) []string {
+	kept := list[:0]
+
+	for _, item := range list {
+		if item != value {
+			kept = append(kept, item)
+		}
+	}
+
+	if len(kept) == 0 {
+		return nil
+	}
+
+	return kept
+}
+
+// HashBlob returns the hex SHA-256 of a blob
+func HashBlob(blob []byte) string {
+	hash := sha256.Sum256(blob)
+
+	return hex.EncodeToString(hash[:])
+}
+
+// NewContentAddressedBlobStore returns a new ContentAddressedBlobStore saving into backend,
+// loading the indexes already saved there if any. PID 0 of backend is reserved for the store
+func NewContentAddressedBlobStore(backend BlobStore) (*ContentAddressedBlobStore, error) {
+	contentAddressedBlobStore := &ContentAddressedBlobStore{
+		backend:   backend,
+		indexes:   make(map[uint32]*contentAddressedIndex),
+		refCounts: make(map[string]int),
+	}
+
+	data, err := backend.GetBlob(0, contentAddressedPlayersKey)
+
+	if errors.Is(err, ErrBlobNotFound) {
+		return contentAddressedBlobStore, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []uint32
+
+	if err := json.Unmarshal(data, &pids); err != nil {
+		return nil, err
+	}
+
+	released := make([]string, 0)
+
+	for _, pid := range pids {
+		data, err := backend.GetBlob(0, contentAddressedIndexPrefix+strconv.FormatUint(uint64(pid), 10))
+
+		if errors.Is(err, ErrBlobNotFound) {
+			data, err = []byte(`{"references":{}}`), nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		index := &contentAddressedIndex{}
+
+		if err := json.Unmarshal(data, index); err != nil {
+			return nil, err
+		}
+
+		if index.References == nil {
+			index.References = make(map[string]string)
+		}
+
+		for _, hash := range index.References {
+			contentAddressedBlobStore.refCounts[hash]++
+		}
+
+		released = append(released, index.Released...)
+		contentAddressedBlobStore.indexes[pid] = index
+	}
+
+	for _, hash := range released {
+		if _, ok := contentAddressedBlobStore.refCounts[hash]; !ok {
+			contentAddressedBlobStore.refCounts[hash] = 0
+		}
+	}
+
+	return contentAddressedBlobStore, nil
+}
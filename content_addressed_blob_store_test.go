@@ -0,0 +1,287 @@
+package nexproto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// crashingBlobStore is a MemoryBlobStore which fails every index save after the first indexSavesLeft, as if the server crashed.
+// A negative indexSavesLeft never fails
+type crashingBlobStore struct {
+	*MemoryBlobStore
+	indexSavesLeft int
+}
+
+func (crashingBlobStore *crashingBlobStore) SaveBlob(pid uint32, key string, blob []byte) error {
+	if strings.HasPrefix(key, contentAddressedIndexPrefix) && crashingBlobStore.indexSavesLeft >= 0 {
+		if crashingBlobStore.indexSavesLeft == 0 {
+			return errors.New("crashed")
+		}
+
+		crashingBlobStore.indexSavesLeft--
+	}
+
+	return crashingBlobStore.MemoryBlobStore.SaveBlob(pid, key, blob)
+}
+
+func countContentAddressedBlobs(memoryBlobStore *MemoryBlobStore) int {
+	memoryBlobStore.mutex.RLock()
+	defer memoryBlobStore.mutex.RUnlock()
+
+	count := 0
+
+	for key := range memoryBlobStore.blobs {
+		if key.pid == 0 && strings.HasPrefix(key.key, contentAddressedBlobPrefix) {
+			count++
+		}
+	}
+
+	return count
+}
+
+func newTestContentAddressedBlobStore(t *testing.T, backend BlobStore) *ContentAddressedBlobStore {
+	t.Helper()
+
+	contentAddressedBlobStore, err := NewContentAddressedBlobStore(backend)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return contentAddressedBlobStore
+}
+
+func TestContentAddressedBlobStoreDeduplicates(t *testing.T) {
+	backend := NewMemoryBlobStore()
+	contentAddressedBlobStore := newTestContentAddressedBlobStore(t, backend)
+	hash := HashBlob([]byte("logo"))
+
+	saves := []struct {
+		pid uint32
+		key string
+	}{
+		{1000, "band_logo/0"},
+		{1001, "band_logo/0"},
+		{1000, "band_logo/1"},
+	}
+
+	for _, save := range saves {
+		if err := contentAddressedBlobStore.SaveBlob(save.pid, save.key, []byte("logo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := countContentAddressedBlobs(backend); count != 1 {
+		t.Fatalf("got %d stored blobs, want 1", count)
+	}
+
+	if refCount := contentAddressedBlobStore.ReferenceCount(hash); refCount != 3 {
+		t.Fatalf("got %d references, want 3", refCount)
+	}
+
+	for _, save := range saves {
+		if blob, err := contentAddressedBlobStore.GetBlob(save.pid, save.key); err != nil || string(blob) != "logo" {
+			t.Fatalf("got %q, %v for %d %s", blob, err, save.pid, save.key)
+		}
+	}
+
+	if storedHash, err := contentAddressedBlobStore.Hash(1001, "band_logo/0"); err != nil || storedHash != hash {
+		t.Fatalf("got hash %q, %v, want %q", storedHash, err, hash)
+	}
+
+	if err := contentAddressedBlobStore.SaveBlob(0, "band_logo/0", []byte("logo")); !errors.Is(err, ErrReservedBlobPID) {
+		t.Fatalf("got %v, want ErrReservedBlobPID", err)
+	}
+}
+
+func TestContentAddressedBlobStoreReferenceCounts(t *testing.T) {
+	backend := NewMemoryBlobStore()
+	contentAddressedBlobStore := newTestContentAddressedBlobStore(t, backend)
+	first := HashBlob([]byte("first"))
+	second := HashBlob([]byte("second"))
+
+	steps := []struct {
+		name      string
+		operation string
+		pid       uint32
+		blob      string
+		first     int
+		second    int
+		collected int
+		stored    int
+	}{
+		{"save first", "save", 1000, "first", 1, 0, 0, 1},
+		{"share first", "save", 1001, "first", 2, 0, 0, 1},
+		{"overwrite with second", "save", 1000, "second", 1, 1, 0, 2},
+		{"nothing to collect", "collect", 0, "", 1, 1, 0, 2},
+		{"overwrite with the same blob", "save", 1000, "second", 1, 1, 0, 2},
+		{"delete last reference to first", "delete", 1001, "", 0, 1, 0, 2},
+		{"first is kept until collected", "collect", 0, "", 0, 1, 1, 1},
+		{"delete second", "delete", 1000, "", 0, 0, 0, 1},
+		{"second is collected", "collect", 0, "", 0, 0, 1, 0},
+	}
+
+	for _, step := range steps {
+		collected := 0
+		var err error
+
+		switch step.operation {
+		case "save":
+			err = contentAddressedBlobStore.SaveBlob(step.pid, "setlist/0", []byte(step.blob))
+		case "delete":
+			err = contentAddressedBlobStore.DeleteBlob(step.pid, "setlist/0")
+		case "collect":
+			collected, err = contentAddressedBlobStore.CollectGarbage()
+		}
+
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		if refCount := contentAddressedBlobStore.ReferenceCount(first); refCount != step.first {
+			t.Fatalf("%s: got %d references to first, want %d", step.name, refCount, step.first)
+		}
+
+		if refCount := contentAddressedBlobStore.ReferenceCount(second); refCount != step.second {
+			t.Fatalf("%s: got %d references to second, want %d", step.name, refCount, step.second)
+		}
+
+		if collected != step.collected {
+			t.Fatalf("%s: collected %d blobs, want %d", step.name, collected, step.collected)
+		}
+
+		if stored := countContentAddressedBlobs(backend); stored != step.stored {
+			t.Fatalf("%s: got %d stored blobs, want %d", step.name, stored, step.stored)
+		}
+	}
+
+	if err := contentAddressedBlobStore.DeleteBlob(1000, "setlist/0"); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("got %v, want ErrBlobNotFound", err)
+	}
+}
+
+func TestContentAddressedBlobStoreReload(t *testing.T) {
+	backend := NewMemoryBlobStore()
+	contentAddressedBlobStore := newTestContentAddressedBlobStore(t, backend)
+
+	for _, pid := range []uint32{1000, 1001} {
+		if err := contentAddressedBlobStore.SaveBlob(pid, "band_logo/0", []byte("logo")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := contentAddressedBlobStore.SaveBlob(1000, "setlist/0", []byte("setlist")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := contentAddressedBlobStore.DeleteBlob(1000, "setlist/0"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestContentAddressedBlobStore(t, backend)
+
+	if refCount := reloaded.ReferenceCount(HashBlob([]byte("logo"))); refCount != 2 {
+		t.Fatalf("got %d references after reloading, want 2", refCount)
+	}
+
+	if blob, err := reloaded.GetBlob(1001, "band_logo/0"); err != nil || string(blob) != "logo" {
+		t.Fatalf("got %q, %v after reloading", blob, err)
+	}
+
+	// the released setlist is still collected after a restart
+	if collected, err := reloaded.CollectGarbage(); err != nil || collected != 1 {
+		t.Fatalf("collected %d, %v, want 1", collected, err)
+	}
+
+	if stored := countContentAddressedBlobs(backend); stored != 1 {
+		t.Fatalf("got %d stored blobs, want 1", stored)
+	}
+}
+
+func TestContentAddressedBlobStoreRewritesCollectedBlob(t *testing.T) {
+	backend := NewMemoryBlobStore()
+	contentAddressedBlobStore := newTestContentAddressedBlobStore(t, backend)
+
+	if err := contentAddressedBlobStore.SaveBlob(1000, "setlist/0", []byte("setlist")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := contentAddressedBlobStore.DeleteBlob(1000, "setlist/0"); err != nil {
+		t.Fatal(err)
+	}
+
+	// CollectGarbage deleted the blob but crashed before it saved the index, which still lists the hash as released
+	if err := backend.DeleteBlob(0, contentAddressedBlobPrefix+HashBlob([]byte("setlist"))); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := newTestContentAddressedBlobStore(t, backend)
+
+	if err := reloaded.SaveBlob(1001, "setlist/0", []byte("setlist")); err != nil {
+		t.Fatal(err)
+	}
+
+	if blob, err := reloaded.GetBlob(1001, "setlist/0"); err != nil || string(blob) != "setlist" {
+		t.Fatalf("got %q, %v, want the blob to be written again", blob, err)
+	}
+}
+
+func TestContentAddressedBlobStoreCrashBeforeIndex(t *testing.T) {
+	backend := &crashingBlobStore{MemoryBlobStore: NewMemoryBlobStore(), indexSavesLeft: -1}
+	contentAddressedBlobStore := newTestContentAddressedBlobStore(t, backend)
+
+	if err := contentAddressedBlobStore.SaveBlob(1000, "band_logo/0", []byte("logo")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the blob is written, then the server crashes before the index refers to it
+	backend.indexSavesLeft = 1
+
+	if err := contentAddressedBlobStore.SaveBlob(1000, "setlist/0", []byte("setlist")); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if stored := countContentAddressedBlobs(backend.MemoryBlobStore); stored != 2 {
+		t.Fatalf("got %d stored blobs, want the orphan and the logo", stored)
+	}
+
+	backend.indexSavesLeft = -1
+	reloaded := newTestContentAddressedBlobStore(t, backend)
+
+	if _, err := reloaded.GetBlob(1000, "setlist/0"); !errors.Is(err, ErrBlobNotFound) {
+		t.Fatalf("got %v, want the unsaved reference to be gone", err)
+	}
+
+	if collected, err := reloaded.CollectGarbage(); err != nil || collected != 1 {
+		t.Fatalf("collected %d, %v, want the orphan", collected, err)
+	}
+
+	if stored := countContentAddressedBlobs(backend.MemoryBlobStore); stored != 1 {
+		t.Fatalf("got %d stored blobs, want only the logo", stored)
+	}
+
+	if blob, err := reloaded.GetBlob(1000, "band_logo/0"); err != nil || string(blob) != "logo" {
+		t.Fatalf("got %q, %v", blob, err)
+	}
+}
+
+func TestContentAddressedBlobStoreIndexFailure(t *testing.T) {
+	backend := &crashingBlobStore{MemoryBlobStore: NewMemoryBlobStore(), indexSavesLeft: -1}
+	contentAddressedBlobStore := newTestContentAddressedBlobStore(t, backend)
+
+	if err := contentAddressedBlobStore.SaveBlob(1000, "band_logo/0", []byte("logo")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a blob is never written unless the index remembers it first
+	backend.indexSavesLeft = 0
+
+	if err := contentAddressedBlobStore.SaveBlob(1000, "setlist/0", []byte("setlist")); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if stored := countContentAddressedBlobs(backend.MemoryBlobStore); stored != 1 {
+		t.Fatalf("got %d stored blobs, want only the logo", stored)
+	}
+}
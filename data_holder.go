@@ -0,0 +1,13 @@
+package nexproto
+
+// DataHolder holds an object of any Data class along with the name of that class
+type DataHolder struct {
+	Name string
+	Data []byte
+}
+
+// ResultRange holds the offset and size of a range of results to return
+type ResultRange struct {
+	Offset uint32
+	Size   uint32
+}
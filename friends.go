@@ -0,0 +1,668 @@
+package nexproto
+
+import (
+	"errors"
+	"log"
+
+	nex "github.com/ihatecompvir/nex-go"
+)
+
+const (
+	// FriendsProtocolID is the protocol ID for the Friends protocol
+	FriendsProtocolID = 0x14
+
+	// FriendsMethodAddFriend is the method ID for the method AddFriend, which sends a friend request to a player
+	FriendsMethodAddFriend = 0x1
+
+	// FriendsMethodAddFriendByName is the method ID for the method AddFriendByName, which sends a friend request to a player by name
+	FriendsMethodAddFriendByName = 0x2
+
+	// FriendsMethodAddFriendWithDetails is the method ID for the method AddFriendWithDetails, which sends a friend request to a player and returns their FriendData
+	FriendsMethodAddFriendWithDetails = 0x3
+
+	// FriendsMethodAddFriendByNameWithDetails is the method ID for the method AddFriendByNameWithDetails, which sends a friend request to a player by name and returns their FriendData
+	FriendsMethodAddFriendByNameWithDetails = 0x4
+
+	// FriendsMethodAcceptFriendship is the method ID for the method AcceptFriendship
+	FriendsMethodAcceptFriendship = 0x5
+
+	// FriendsMethodDeclineFriendship is the method ID for the method DeclineFriendship
+	FriendsMethodDeclineFriendship = 0x6
+
+	// FriendsMethodBlackList is the method ID for the method BlackList
+	FriendsMethodBlackList = 0x7
+
+	// FriendsMethodBlackListByName is the method ID for the method BlackListByName
+	FriendsMethodBlackListByName = 0x8
+
+	// FriendsMethodClearRelationship is the method ID for the method ClearRelationship, which removes a friend, pending request or blacklist entry
+	FriendsMethodClearRelationship = 0x9
+
+	// FriendsMethodUpdateDetails is the method ID for the method UpdateDetails
+	FriendsMethodUpdateDetails = 0xA
+
+	// FriendsMethodGetList is the method ID for the method GetList, which returns the PIDs on the friend list with a given relationship
+	FriendsMethodGetList = 0xB
+
+	// FriendsMethodGetDetailedList is the method ID for the method GetDetailedList, which returns the FriendData of everyone on the friend list with a given relationship
+	FriendsMethodGetDetailedList = 0xC
+
+	// FriendsMethodGetRelationships is the method ID for the method GetRelationships
+	FriendsMethodGetRelationships = 0xD
+)
+
+// FriendsProtocol handles the Friends nex protocol
+type FriendsProtocol struct {
+	server                            *nex.Server
+	AddFriendHandler                  func(err error, client *nex.Client, callID uint32, pid uint32, details uint32, message string)
+	AddFriendByNameHandler            func(err error, client *nex.Client, callID uint32, name string, details uint32, message string)
+	AddFriendWithDetailsHandler       func(err error, client *nex.Client, callID uint32, pid uint32, details uint32, message string)
+	AddFriendByNameWithDetailsHandler func(err error, client *nex.Client, callID uint32, name string, details uint32, message string)
+	AcceptFriendshipHandler           func(err error, client *nex.Client, callID uint32, pid uint32)
+	DeclineFriendshipHandler          func(err error, client *nex.Client, callID uint32, pid uint32)
+	BlackListHandler                  func(err error, client *nex.Client, callID uint32, pid uint32, details uint32)
+	BlackListByNameHandler            func(err error, client *nex.Client, callID uint32, name string, details uint32)
+	ClearRelationshipHandler          func(err error, client *nex.Client, callID uint32, pid uint32)
+	UpdateDetailsHandler              func(err error, client *nex.Client, callID uint32, pid uint32, details uint32)
+	GetListHandler                    func(err error, client *nex.Client, callID uint32, relationship uint8, reversed bool)
+	GetDetailedListHandler            func(err error, client *nex.Client, callID uint32, relationship uint8, reversed bool)
+	GetRelationshipsHandler           func(err error, client *nex.Client, callID uint32, resultRange *ResultRange)
+}
+
+// FriendData holds a player on the friend list and their status
+type FriendData struct {
+	PID          uint32
+	Name         string
+	Relationship uint8
+	Details      uint32
+	Status       string
+}
+
+// Bytes encodes the FriendData and returns a byte array
+func (friendData *FriendData) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt32LE(friendData.PID)
+	stream.Write4ByteString(friendData.Name)
+	stream.WriteUInt8(friendData.Relationship)
+	stream.WriteUInt32LE(friendData.Details)
+	stream.Write4ByteString(friendData.Status)
+
+	return stream.Bytes()
+}
+
+// RelationshipData holds a relationship returned by GetRelationships
+type RelationshipData struct {
+	PID          uint32
+	Name         string
+	Relationship uint8
+	Details      uint32
+	Status       uint8
+}
+
+// Bytes encodes the RelationshipData and returns a byte array
+func (relationshipData *RelationshipData) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt32LE(relationshipData.PID)
+	stream.Write4ByteString(relationshipData.Name)
+	stream.WriteUInt8(relationshipData.Relationship)
+	stream.WriteUInt32LE(relationshipData.Details)
+	stream.WriteUInt8(relationshipData.Status)
+
+	return stream.Bytes()
+}
+
+// BlacklistedPrincipal holds a player on the blacklist
+type BlacklistedPrincipal struct {
+	PID     uint32
+	Name    string
+	Details uint32
+}
+
+// Bytes encodes the BlacklistedPrincipal and returns a byte array
+func (blacklistedPrincipal *BlacklistedPrincipal) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt32LE(blacklistedPrincipal.PID)
+	stream.Write4ByteString(blacklistedPrincipal.Name)
+	stream.WriteUInt32LE(blacklistedPrincipal.Details)
+
+	return stream.Bytes()
+}
+
+// Setup initializes the protocol
+func (friendsProtocol *FriendsProtocol) Setup() {
+	nexServer := friendsProtocol.server
+
+	nexServer.On("Data", func(packet nex.PacketInterface) {
+		request := packet.RMCRequest()
+
+		if FriendsProtocolID == request.ProtocolID() {
+			switch request.MethodID() {
+			case FriendsMethodAddFriend:
+				go friendsProtocol.handleAddFriend(packet)
+			case FriendsMethodAddFriendByName:
+				go friendsProtocol.handleAddFriendByName(packet)
+			case FriendsMethodAddFriendWithDetails:
+				go friendsProtocol.handleAddFriendWithDetails(packet)
+			case FriendsMethodAddFriendByNameWithDetails:
+				go friendsProtocol.handleAddFriendByNameWithDetails(packet)
+			case FriendsMethodAcceptFriendship:
+				go friendsProtocol.handleAcceptFriendship(packet)
+			case FriendsMethodDeclineFriendship:
+				go friendsProtocol.handleDeclineFriendship(packet)
+			case FriendsMethodBlackList:
+				go friendsProtocol.handleBlackList(packet)
+			case FriendsMethodBlackListByName:
+				go friendsProtocol.handleBlackListByName(packet)
+			case FriendsMethodClearRelationship:
+				go friendsProtocol.handleClearRelationship(packet)
+			case FriendsMethodUpdateDetails:
+				go friendsProtocol.handleUpdateDetails(packet)
+			case FriendsMethodGetList:
+				go friendsProtocol.handleGetList(packet)
+			case FriendsMethodGetDetailedList:
+				go friendsProtocol.handleGetDetailedList(packet)
+			case FriendsMethodGetRelationships:
+				go friendsProtocol.handleGetRelationships(packet)
+			default:
+				log.Printf("Unsupported Friends method ID: %#v\n", request.MethodID())
+			}
+		}
+	})
+}
+
+// AddFriend sets the AddFriend handler function
+func (friendsProtocol *FriendsProtocol) AddFriend(handler func(err error, client *nex.Client, callID uint32, pid uint32, details uint32, message string)) {
+	friendsProtocol.AddFriendHandler = handler
+}
+
+// AddFriendByName sets the AddFriendByName handler function
+func (friendsProtocol *FriendsProtocol) AddFriendByName(handler func(err error, client *nex.Client, callID uint32, name string, details uint32, message string)) {
+	friendsProtocol.AddFriendByNameHandler = handler
+}
+
+// AddFriendWithDetails sets the AddFriendWithDetails handler function
+func (friendsProtocol *FriendsProtocol) AddFriendWithDetails(handler func(err error, client *nex.Client, callID uint32, pid uint32, details uint32, message string)) {
+	friendsProtocol.AddFriendWithDetailsHandler = handler
+}
+
+// AddFriendByNameWithDetails sets the AddFriendByNameWithDetails handler function
+func (friendsProtocol *FriendsProtocol) AddFriendByNameWithDetails(handler func(err error, client *nex.Client, callID uint32, name string, details uint32, message string)) {
+	friendsProtocol.AddFriendByNameWithDetailsHandler = handler
+}
+
+// AcceptFriendship sets the AcceptFriendship handler function
+func (friendsProtocol *FriendsProtocol) AcceptFriendship(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	friendsProtocol.AcceptFriendshipHandler = handler
+}
+
+// DeclineFriendship sets the DeclineFriendship handler function
+func (friendsProtocol *FriendsProtocol) DeclineFriendship(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	friendsProtocol.DeclineFriendshipHandler = handler
+}
+
+// BlackList sets the BlackList handler function
+func (friendsProtocol *FriendsProtocol) BlackList(handler func(err error, client *nex.Client, callID uint32, pid uint32, details uint32)) {
+	friendsProtocol.BlackListHandler = handler
+}
+
+// BlackListByName sets the BlackListByName handler function
+func (friendsProtocol *FriendsProtocol) BlackListByName(handler func(err error, client *nex.Client, callID uint32, name string, details uint32)) {
+	friendsProtocol.BlackListByNameHandler = handler
+}
+
+// ClearRelationship sets the ClearRelationship handler function
+func (friendsProtocol *FriendsProtocol) ClearRelationship(handler func(err error, client *nex.Client, callID uint32, pid uint32)) {
+	friendsProtocol.ClearRelationshipHandler = handler
+}
+
+// UpdateDetails sets the UpdateDetails handler function
+func (friendsProtocol *FriendsProtocol) UpdateDetails(handler func(err error, client *nex.Client, callID uint32, pid uint32, details uint32)) {
+	friendsProtocol.UpdateDetailsHandler = handler
+}
+
+// GetList sets the GetList handler function
+func (friendsProtocol *FriendsProtocol) GetList(handler func(err error, client *nex.Client, callID uint32, relationship uint8, reversed bool)) {
+	friendsProtocol.GetListHandler = handler
+}
+
+// GetDetailedList sets the GetDetailedList handler function
+func (friendsProtocol *FriendsProtocol) GetDetailedList(handler func(err error, client *nex.Client, callID uint32, relationship uint8, reversed bool)) {
+	friendsProtocol.GetDetailedListHandler = handler
+}
+
+// GetRelationships sets the GetRelationships handler function
+func (friendsProtocol *FriendsProtocol) GetRelationships(handler func(err error, client *nex.Client, callID uint32, resultRange *ResultRange)) {
+	friendsProtocol.GetRelationshipsHandler = handler
+}
+
+func (friendsProtocol *FriendsProtocol) handleAddFriend(packet nex.PacketInterface) {
+	if friendsProtocol.AddFriendHandler == nil {
+		log.Println("[Warning] FriendsProtocol::AddFriend not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AddFriend] Data missing PID")
+		go friendsProtocol.AddFriendHandler(err, client, callID, 0, 0, "")
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AddFriend] Data missing details")
+		go friendsProtocol.AddFriendHandler(err, client, callID, 0, 0, "")
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	message, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.AddFriendHandler(err, client, callID, 0, 0, "")
+		return
+	}
+
+	go friendsProtocol.AddFriendHandler(nil, client, callID, pid, details, message)
+}
+
+func (friendsProtocol *FriendsProtocol) handleAddFriendByName(packet nex.PacketInterface) {
+	if friendsProtocol.AddFriendByNameHandler == nil {
+		log.Println("[Warning] FriendsProtocol::AddFriendByName not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	name, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.AddFriendByNameHandler(err, client, callID, "", 0, "")
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AddFriendByName] Data missing details")
+		go friendsProtocol.AddFriendByNameHandler(err, client, callID, "", 0, "")
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	message, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.AddFriendByNameHandler(err, client, callID, "", 0, "")
+		return
+	}
+
+	go friendsProtocol.AddFriendByNameHandler(nil, client, callID, name, details, message)
+}
+
+func (friendsProtocol *FriendsProtocol) handleAddFriendWithDetails(packet nex.PacketInterface) {
+	if friendsProtocol.AddFriendWithDetailsHandler == nil {
+		log.Println("[Warning] FriendsProtocol::AddFriendWithDetails not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AddFriendWithDetails] Data missing PID")
+		go friendsProtocol.AddFriendWithDetailsHandler(err, client, callID, 0, 0, "")
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AddFriendWithDetails] Data missing details")
+		go friendsProtocol.AddFriendWithDetailsHandler(err, client, callID, 0, 0, "")
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	message, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.AddFriendWithDetailsHandler(err, client, callID, 0, 0, "")
+		return
+	}
+
+	go friendsProtocol.AddFriendWithDetailsHandler(nil, client, callID, pid, details, message)
+}
+
+func (friendsProtocol *FriendsProtocol) handleAddFriendByNameWithDetails(packet nex.PacketInterface) {
+	if friendsProtocol.AddFriendByNameWithDetailsHandler == nil {
+		log.Println("[Warning] FriendsProtocol::AddFriendByNameWithDetails not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	name, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.AddFriendByNameWithDetailsHandler(err, client, callID, "", 0, "")
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AddFriendByNameWithDetails] Data missing details")
+		go friendsProtocol.AddFriendByNameWithDetailsHandler(err, client, callID, "", 0, "")
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	message, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.AddFriendByNameWithDetailsHandler(err, client, callID, "", 0, "")
+		return
+	}
+
+	go friendsProtocol.AddFriendByNameWithDetailsHandler(nil, client, callID, name, details, message)
+}
+
+func (friendsProtocol *FriendsProtocol) handleAcceptFriendship(packet nex.PacketInterface) {
+	if friendsProtocol.AcceptFriendshipHandler == nil {
+		log.Println("[Warning] FriendsProtocol::AcceptFriendship not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::AcceptFriendship] Data missing PID")
+		go friendsProtocol.AcceptFriendshipHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go friendsProtocol.AcceptFriendshipHandler(nil, client, callID, pid)
+}
+
+func (friendsProtocol *FriendsProtocol) handleDeclineFriendship(packet nex.PacketInterface) {
+	if friendsProtocol.DeclineFriendshipHandler == nil {
+		log.Println("[Warning] FriendsProtocol::DeclineFriendship not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::DeclineFriendship] Data missing PID")
+		go friendsProtocol.DeclineFriendshipHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go friendsProtocol.DeclineFriendshipHandler(nil, client, callID, pid)
+}
+
+func (friendsProtocol *FriendsProtocol) handleBlackList(packet nex.PacketInterface) {
+	if friendsProtocol.BlackListHandler == nil {
+		log.Println("[Warning] FriendsProtocol::BlackList not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::BlackList] Data missing PID")
+		go friendsProtocol.BlackListHandler(err, client, callID, 0, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::BlackList] Data missing details")
+		go friendsProtocol.BlackListHandler(err, client, callID, 0, 0)
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	go friendsProtocol.BlackListHandler(nil, client, callID, pid, details)
+}
+
+func (friendsProtocol *FriendsProtocol) handleBlackListByName(packet nex.PacketInterface) {
+	if friendsProtocol.BlackListByNameHandler == nil {
+		log.Println("[Warning] FriendsProtocol::BlackListByName not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	name, err := parametersStream.Read4ByteString()
+	if err != nil {
+		go friendsProtocol.BlackListByNameHandler(err, client, callID, "", 0)
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::BlackListByName] Data missing details")
+		go friendsProtocol.BlackListByNameHandler(err, client, callID, "", 0)
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	go friendsProtocol.BlackListByNameHandler(nil, client, callID, name, details)
+}
+
+func (friendsProtocol *FriendsProtocol) handleClearRelationship(packet nex.PacketInterface) {
+	if friendsProtocol.ClearRelationshipHandler == nil {
+		log.Println("[Warning] FriendsProtocol::ClearRelationship not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::ClearRelationship] Data missing PID")
+		go friendsProtocol.ClearRelationshipHandler(err, client, callID, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	go friendsProtocol.ClearRelationshipHandler(nil, client, callID, pid)
+}
+
+func (friendsProtocol *FriendsProtocol) handleUpdateDetails(packet nex.PacketInterface) {
+	if friendsProtocol.UpdateDetailsHandler == nil {
+		log.Println("[Warning] FriendsProtocol::UpdateDetails not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::UpdateDetails] Data missing PID")
+		go friendsProtocol.UpdateDetailsHandler(err, client, callID, 0, 0)
+		return
+	}
+
+	pid := parametersStream.ReadUInt32LE()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[FriendsProtocol::UpdateDetails] Data missing details")
+		go friendsProtocol.UpdateDetailsHandler(err, client, callID, 0, 0)
+		return
+	}
+
+	details := parametersStream.ReadUInt32LE()
+
+	go friendsProtocol.UpdateDetailsHandler(nil, client, callID, pid, details)
+}
+
+func (friendsProtocol *FriendsProtocol) handleGetList(packet nex.PacketInterface) {
+	if friendsProtocol.GetListHandler == nil {
+		log.Println("[Warning] FriendsProtocol::GetList not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 1 {
+		err := errors.New("[FriendsProtocol::GetList] Data missing relationship")
+		go friendsProtocol.GetListHandler(err, client, callID, 0, false)
+		return
+	}
+
+	relationship := parametersStream.ReadUInt8()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 1 {
+		err := errors.New("[FriendsProtocol::GetList] Data missing reversed flag")
+		go friendsProtocol.GetListHandler(err, client, callID, 0, false)
+		return
+	}
+
+	reversed := parametersStream.ReadBool()
+
+	go friendsProtocol.GetListHandler(nil, client, callID, relationship, reversed)
+}
+
+func (friendsProtocol *FriendsProtocol) handleGetDetailedList(packet nex.PacketInterface) {
+	if friendsProtocol.GetDetailedListHandler == nil {
+		log.Println("[Warning] FriendsProtocol::GetDetailedList not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 1 {
+		err := errors.New("[FriendsProtocol::GetDetailedList] Data missing relationship")
+		go friendsProtocol.GetDetailedListHandler(err, client, callID, 0, false)
+		return
+	}
+
+	relationship := parametersStream.ReadUInt8()
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 1 {
+		err := errors.New("[FriendsProtocol::GetDetailedList] Data missing reversed flag")
+		go friendsProtocol.GetDetailedListHandler(err, client, callID, 0, false)
+		return
+	}
+
+	reversed := parametersStream.ReadBool()
+
+	go friendsProtocol.GetDetailedListHandler(nil, client, callID, relationship, reversed)
+}
+
+func (friendsProtocol *FriendsProtocol) handleGetRelationships(packet nex.PacketInterface) {
+	if friendsProtocol.GetRelationshipsHandler == nil {
+		log.Println("[Warning] FriendsProtocol::GetRelationships not implemented")
+		go respondNotImplemented(packet, FriendsProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, friendsProtocol.server)
+
+	resultRange, err := parametersStream.ReadResultRange()
+	if err != nil {
+		go friendsProtocol.GetRelationshipsHandler(err, client, callID, nil)
+		return
+	}
+
+	go friendsProtocol.GetRelationshipsHandler(nil, client, callID, resultRange)
+}
+
+// NewFriendsProtocol returns a new FriendsProtocol
+func NewFriendsProtocol(server *nex.Server) *FriendsProtocol {
+	friendsProtocol := &FriendsProtocol{server: server}
+
+	friendsProtocol.Setup()
+
+	return friendsProtocol
+}
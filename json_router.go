@@ -0,0 +1,141 @@
+package nexproto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	nex "github.com/ihatecompvir/nex-go"
+)
+
+// DefaultJSONOperationField is the default name of the JSON field holding the operation of a JsonRequest
+const DefaultJSONOperationField = "op"
+
+type jsonRoute func(client *nex.Client, envelope map[string]json.RawMessage) (interface{}, error)
+
+// JSONRouter dispatches JsonRequest calls to typed handlers by the operation named in the request.
+// Register handlers with HandleJSON and set HandleJSONRequest as the JSONRequest handler.
+// Requests which fail to decode or validate are answered with CoreInvalidArgument
+type JSONRouter struct {
+	OperationField string
+
+	// DisallowUnknownFields rejects requests with fields their request type doesn't have
+	DisallowUnknownFields bool
+
+	jsonProtocol *JsonProtocol
+	mutex        sync.RWMutex
+	routes       map[string]jsonRoute
+}
+
+// HandleJSON registers fn as the handler of an operation.
+// The request without its operation field is decoded into Req and checked against its validate tags (see ValidateJSON),
+// and the value returned by fn is encoded as the response
+func HandleJSON[Req any, Resp any](jsonRouter *JSONRouter, operation string, fn func(client *nex.Client, request *Req) (*Resp, error)) {
+	route := func(client *nex.Client, envelope map[string]json.RawMessage) (interface{}, error) {
+		delete(envelope, jsonRouter.OperationField)
+
+		rawJson, err := json.Marshal(envelope)
+
+		if err != nil {
+			return nil, err
+		}
+
+		request := new(Req)
+
+		if err := decodeJSON(rawJson, request, jsonRouter.DisallowUnknownFields); err != nil {
+			return nil, fmt.Errorf("[JSONRouter] Invalid %s request: %w", operation, err)
+		}
+
+		return fn(client, request)
+	}
+
+	jsonRouter.mutex.Lock()
+	defer jsonRouter.mutex.Unlock()
+
+	jsonRouter.routes[operation] = route
+}
+
+// HandleJSONRequest is a JSONRequest handler which routes the request to the handler of its operation
+func (jsonRouter *JSONRouter) HandleJSONRequest(err error, client *nex.Client, callID uint32, rawJson string) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, JsonProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	response, resultCode, err := jsonRouter.dispatch(client, rawJson)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, JsonProtocolID, callID, resultCode)
+		return
+	}
+
+	if err := jsonRouter.jsonProtocol.RespondJSON(client, callID, JsonRequest, response); err != nil {
+		log.Println(err)
+	}
+}
+
+// dispatch runs the handler of the operation named in a request, returning its response,
+// or the result code to respond with and the error if the request could not be handled
+func (jsonRouter *JSONRouter) dispatch(client *nex.Client, rawJson string) (interface{}, uint32, error) {
+	envelope, operation, err := jsonRouter.operation(rawJson)
+
+	if err != nil {
+		return nil, ResultCodeCoreInvalidArgument, err
+	}
+
+	jsonRouter.mutex.RLock()
+	route, ok := jsonRouter.routes[operation]
+	jsonRouter.mutex.RUnlock()
+
+	if !ok {
+		return nil, ResultCodeCoreNotImplemented, fmt.Errorf("[JSONRouter] No handler for operation %q", operation)
+	}
+
+	response, err := route(client, envelope)
+
+	if errors.Is(err, ErrInvalidJSON) {
+		return nil, ResultCodeCoreInvalidArgument, err
+	}
+
+	if err != nil {
+		return nil, ResultCodeCoreUnknown, err
+	}
+
+	return response, ResultCodeSuccess, nil
+}
+
+// operation returns the fields of a request and the operation named in it
+func (jsonRouter *JSONRouter) operation(rawJson string) (map[string]json.RawMessage, string, error) {
+	var envelope map[string]json.RawMessage
+
+	if err := json.Unmarshal([]byte(rawJson), &envelope); err != nil {
+		return nil, "", fmt.Errorf("[JSONRouter] Invalid request: %w", err)
+	}
+
+	rawOperation, ok := envelope[jsonRouter.OperationField]
+
+	if !ok {
+		return nil, "", errors.New("[JSONRouter] Request missing " + jsonRouter.OperationField)
+	}
+
+	var operation string
+
+	if err := json.Unmarshal(rawOperation, &operation); err != nil {
+		return nil, "", fmt.Errorf("[JSONRouter] Invalid %s: %w", jsonRouter.OperationField, err)
+	}
+
+	return envelope, operation, nil
+}
+
+// NewJSONRouter returns a new JSONRouter sending its responses through jsonProtocol
+func NewJSONRouter(jsonProtocol *JsonProtocol) *JSONRouter {
+	return &JSONRouter{
+		OperationField: DefaultJSONOperationField,
+		jsonProtocol:   jsonProtocol,
+		routes:         make(map[string]jsonRoute),
+	}
+}
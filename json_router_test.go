@@ -0,0 +1,127 @@
+package nexproto
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	nex "github.com/ihatecompvir/nex-go"
+)
+
+type testScoreRequest struct {
+	Song  string `json:"song" validate:"required,max=8"`
+	Score int    `json:"score" validate:"min=0"`
+}
+
+type testScoreResponse struct {
+	Rank int `json:"rank"`
+}
+
+func newTestJSONRouter(disallowUnknownFields bool) *JSONRouter {
+	jsonRouter := NewJSONRouter(nil)
+	jsonRouter.DisallowUnknownFields = disallowUnknownFields
+
+	HandleJSON(jsonRouter, "save_score", func(client *nex.Client, request *testScoreRequest) (*testScoreResponse, error) {
+		return &testScoreResponse{Rank: request.Score / 100}, nil
+	})
+
+	HandleJSON(jsonRouter, "fail", func(client *nex.Client, request *testScoreRequest) (*testScoreResponse, error) {
+		return nil, errors.New("handler failed")
+	})
+
+	return jsonRouter
+}
+
+func TestJSONRouterDispatch(t *testing.T) {
+	tests := []struct {
+		name                  string
+		disallowUnknownFields bool
+		rawJson               string
+		resultCode            uint32
+		response              string
+	}{
+		{"dispatches to handler", false, `{"op":"save_score","song":"song","score":1234}`, ResultCodeSuccess, `{"rank":12}`},
+		{"ignores unknown fields by default", false, `{"op":"save_score","song":"song","score":100,"extra":1}`, ResultCodeSuccess, `{"rank":1}`},
+		{"allows operation field with unknown fields disallowed", true, `{"op":"save_score","song":"song","score":100}`, ResultCodeSuccess, `{"rank":1}`},
+		{"unknown field disallowed", true, `{"op":"save_score","song":"song","extra":1}`, ResultCodeCoreInvalidArgument, ""},
+		{"unknown operation", false, `{"op":"delete_everything"}`, ResultCodeCoreNotImplemented, ""},
+		{"missing operation", false, `{"song":"song"}`, ResultCodeCoreInvalidArgument, ""},
+		{"operation not a string", false, `{"op":1}`, ResultCodeCoreInvalidArgument, ""},
+		{"not an object", false, `[1,2,3]`, ResultCodeCoreInvalidArgument, ""},
+		{"not JSON", false, `save_score`, ResultCodeCoreInvalidArgument, ""},
+		{"wrong field type", false, `{"op":"save_score","song":"song","score":"high"}`, ResultCodeCoreInvalidArgument, ""},
+		{"missing required field", false, `{"op":"save_score","score":1}`, ResultCodeCoreInvalidArgument, ""},
+		{"field over max", false, `{"op":"save_score","song":"much too long"}`, ResultCodeCoreInvalidArgument, ""},
+		{"handler error", false, `{"op":"fail","song":"song"}`, ResultCodeCoreUnknown, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jsonRouter := newTestJSONRouter(test.disallowUnknownFields)
+
+			response, resultCode, err := jsonRouter.dispatch(nil, test.rawJson)
+
+			if resultCode != test.resultCode {
+				t.Fatalf("got result code %#x, want %#x (error: %v)", resultCode, test.resultCode, err)
+			}
+
+			if test.resultCode != ResultCodeSuccess {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rawResponse, err := json.Marshal(response)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(rawResponse) != test.response {
+				t.Fatalf("got response %s, want %s", rawResponse, test.response)
+			}
+		})
+	}
+}
+
+func TestJSONRouterInvalidRequestsWrapErrInvalidJSON(t *testing.T) {
+	jsonRouter := newTestJSONRouter(true)
+
+	tests := []struct {
+		name    string
+		rawJson string
+	}{
+		{"wrong field type", `{"op":"save_score","song":"song","score":"high"}`},
+		{"unknown field", `{"op":"save_score","song":"song","extra":1}`},
+		{"missing required field", `{"op":"save_score"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := jsonRouter.dispatch(nil, test.rawJson)
+
+			if !errors.Is(err, ErrInvalidJSON) {
+				t.Fatalf("got %v, want ErrInvalidJSON", err)
+			}
+		})
+	}
+}
+
+func TestJSONRouterCustomOperationField(t *testing.T) {
+	jsonRouter := newTestJSONRouter(true)
+	jsonRouter.OperationField = "method"
+
+	if _, resultCode, err := jsonRouter.dispatch(nil, `{"method":"save_score","song":"song"}`); resultCode != ResultCodeSuccess {
+		t.Fatalf("got result code %#x: %v", resultCode, err)
+	}
+
+	if _, resultCode, _ := jsonRouter.dispatch(nil, `{"op":"save_score","song":"song"}`); resultCode != ResultCodeCoreInvalidArgument {
+		t.Fatalf("got result code %#x, want CoreInvalidArgument", resultCode)
+	}
+}
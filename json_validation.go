@@ -0,0 +1,227 @@
+package nexproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Suggested JsonProtocol request limits, requests are not limited unless MaxJSONRequestSize or MaxJSONDepth is set
+const (
+	DefaultMaxJSONRequestSize = 64 * 1024
+	DefaultMaxJSONDepth       = 32
+)
+
+// ErrInvalidJSON is wrapped by every error caused by a JSON request failing to decode or validate
+var ErrInvalidJSON = errors.New("[JSONValidation] Invalid JSON")
+
+// checkJSONLimits makes sure rawJson holds exactly one JSON value no larger than maxSize bytes
+// and nested no deeper than maxDepth. Zero limits are not enforced, and nothing is checked if both are zero
+func checkJSONLimits(rawJson string, maxSize int, maxDepth int) error {
+	if maxSize <= 0 && maxDepth <= 0 {
+		return nil
+	}
+
+	if maxSize > 0 && len(rawJson) > maxSize {
+		return fmt.Errorf("%w: %d bytes is larger than %d", ErrInvalidJSON, len(rawJson), maxSize)
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(rawJson))
+	depth := 0
+	values := 0
+
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+		}
+
+		if depth == 0 {
+			values++
+
+			if values > 1 {
+				return fmt.Errorf("%w: more than one value", ErrInvalidJSON)
+			}
+		}
+
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+
+			if maxDepth > 0 && depth > maxDepth {
+				return fmt.Errorf("%w: nested deeper than %d", ErrInvalidJSON, maxDepth)
+			}
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+	}
+
+	if values == 0 {
+		return fmt.Errorf("%w: empty request", ErrInvalidJSON)
+	}
+
+	if depth != 0 {
+		return fmt.Errorf("%w: unexpected end of JSON", ErrInvalidJSON)
+	}
+
+	return nil
+}
+
+// decodeJSON decodes rawJson into v and validates it with ValidateJSON
+func decodeJSON(rawJson []byte, v any, disallowUnknownFields bool) error {
+	decoder := json.NewDecoder(bytes.NewReader(rawJson))
+
+	if disallowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+
+	return ValidateJSON(v)
+}
+
+// ValidateJSON checks a decoded request against the validate tags of its struct fields.
+// The supported rules are required, which rejects zero values, and min=N and max=N,
+// which bound the value of numbers and the length of strings, slices and maps.
+// Nested structs, pointers and slices of structs are validated as well
+//
+//	type SaveScoreRequest struct {
+//		Song  string `json:"song" validate:"required,max=64"`
+//		Score int    `json:"score" validate:"min=0"`
+//	}
+func ValidateJSON(v any) error {
+	return validateJSONValue(reflect.ValueOf(v), "")
+}
+
+func validateJSONValue(value reflect.Value, path string) error {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		return validateJSONValue(value.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := validateJSONValue(value.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		valueType := value.Type()
+
+		for i := 0; i < valueType.NumField(); i++ {
+			field := valueType.Field(i)
+
+			if !field.IsExported() {
+				continue
+			}
+
+			fieldPath := jsonFieldName(field)
+
+			if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+
+			if err := validateJSONField(value.Field(i), field.Tag.Get("validate"), fieldPath); err != nil {
+				return err
+			}
+
+			if err := validateJSONValue(value.Field(i), fieldPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateJSONField checks one field against the rules of its validate tag
+func validateJSONField(value reflect.Value, rules string, path string) error {
+	if rules == "" {
+		return nil
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		name, argument, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		switch name {
+		case "required":
+			if value.IsZero() {
+				return fmt.Errorf("%w: %s is required", ErrInvalidJSON, path)
+			}
+		case "min", "max":
+			limit, err := strconv.ParseFloat(argument, 64)
+
+			if err != nil {
+				return fmt.Errorf("[JSONValidation] Invalid %s rule on %s", name, path)
+			}
+
+			size, ok := jsonFieldSize(value)
+
+			if !ok {
+				return fmt.Errorf("[JSONValidation] %s rule not supported on %s", name, path)
+			}
+
+			if name == "min" && size < limit {
+				return fmt.Errorf("%w: %s is less than %s", ErrInvalidJSON, path, argument)
+			}
+
+			if name == "max" && size > limit {
+				return fmt.Errorf("%w: %s is more than %s", ErrInvalidJSON, path, argument)
+			}
+		default:
+			return fmt.Errorf("[JSONValidation] Unknown rule %q on %s", name, path)
+		}
+	}
+
+	return nil
+}
+
+// jsonFieldSize returns the value of a number, or the length of a string, slice or map, for min and max
+func jsonFieldSize(value reflect.Value) (float64, bool) {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			return 0, true
+		}
+
+		return jsonFieldSize(value.Elem())
+	case reflect.String:
+		return float64(utf8.RuneCountInString(value.String())), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), true
+	}
+
+	return 0, false
+}
+
+// jsonFieldName returns the name a struct field has in JSON, for error messages
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+	if name == "" || name == "-" {
+		return field.Name
+	}
+
+	return name
+}
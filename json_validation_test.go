@@ -0,0 +1,183 @@
+package nexproto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCheckJSONLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawJson  string
+		maxSize  int
+		maxDepth int
+		wantErr  bool
+	}{
+		{"no limits skip checking", "not json", 0, 0, false},
+		{"no limits allow empty", "", 0, 0, false},
+		{"valid object", `{"a":[1,{"b":2}]}`, 100, 3, false},
+		{"valid scalar", `42`, 100, 1, false},
+		{"exactly max size", `"abc"`, 5, 0, false},
+		{"over max size", `"abcd"`, 5, 0, true},
+		{"exactly max depth", `[[1]]`, 0, 2, false},
+		{"over max depth", `[[[1]]]`, 0, 2, true},
+		{"depth of siblings", `[[1],[2],[3]]`, 0, 2, false},
+		{"empty with a limit", "", 100, 0, true},
+		{"whitespace with a limit", "  ", 100, 0, true},
+		{"not json with a limit", "not json", 100, 0, true},
+		{"multiple values", `{} {}`, 100, 0, true},
+		{"trailing scalar", `[1] 2`, 100, 0, true},
+		{"truncated object", `{"a":1`, 100, 0, true},
+		{"truncated array", `[1,[2]`, 100, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkJSONLimits(test.rawJson, test.maxSize, test.maxDepth)
+
+			if test.wantErr && !errors.Is(err, ErrInvalidJSON) {
+				t.Fatalf("got %v, want ErrInvalidJSON", err)
+			}
+
+			if !test.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+type testValidateItem struct {
+	Name string `json:"name" validate:"required"`
+}
+
+type testValidateRequest struct {
+	Song     string             `json:"song" validate:"required,max=5"`
+	Score    int                `json:"score" validate:"min=0,max=100"`
+	Ratio    float64            `json:"ratio" validate:"max=1.5"`
+	Tags     []string           `json:"tags" validate:"max=2"`
+	Items    []testValidateItem `json:"items"`
+	Optional *testValidateItem  `json:"optional"`
+	Nested   testValidateItem   `json:"nested"`
+}
+
+func validTestValidateRequest() testValidateRequest {
+	return testValidateRequest{
+		Song:   "song",
+		Score:  50,
+		Ratio:  1,
+		Tags:   []string{"a"},
+		Items:  []testValidateItem{{Name: "item"}},
+		Nested: testValidateItem{Name: "nested"},
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(request *testValidateRequest)
+		path   string
+	}{
+		{"valid", func(request *testValidateRequest) {}, ""},
+		{"missing required", func(request *testValidateRequest) { request.Song = "" }, "song"},
+		{"string over max", func(request *testValidateRequest) { request.Song = "toolong" }, "song"},
+		{"max counts runes", func(request *testValidateRequest) { request.Song = "ééééé" }, ""},
+		{"number under min", func(request *testValidateRequest) { request.Score = -1 }, "score"},
+		{"number over max", func(request *testValidateRequest) { request.Score = 101 }, "score"},
+		{"fractional max", func(request *testValidateRequest) { request.Ratio = 1.6 }, "ratio"},
+		{"slice over max", func(request *testValidateRequest) { request.Tags = []string{"a", "b", "c"} }, "tags"},
+		{"invalid slice element", func(request *testValidateRequest) {
+			request.Items = append(request.Items, testValidateItem{})
+		}, "items[1].name"},
+		{"nil pointer", func(request *testValidateRequest) { request.Optional = nil }, ""},
+		{"invalid pointer", func(request *testValidateRequest) { request.Optional = &testValidateItem{} }, "optional.name"},
+		{"invalid nested struct", func(request *testValidateRequest) { request.Nested.Name = "" }, "nested.name"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := validTestValidateRequest()
+			test.modify(&request)
+
+			err := ValidateJSON(&request)
+
+			if test.path == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidJSON) {
+				t.Fatalf("got %v, want ErrInvalidJSON", err)
+			}
+
+			if !strings.Contains(err.Error(), test.path) {
+				t.Fatalf("error %q does not name %s", err, test.path)
+			}
+		})
+	}
+}
+
+func TestValidateJSONInvalidRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{"unknown rule", &struct {
+			A string `validate:"email"`
+		}{}},
+		{"invalid limit", &struct {
+			A int `validate:"max=ten"`
+		}{}},
+		{"unsupported kind", &struct {
+			A bool `validate:"min=1"`
+		}{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateJSON(test.value)
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			// a broken tag is a bug in the server, not an invalid request
+			if errors.Is(err, ErrInvalidJSON) {
+				t.Fatalf("got %v, want an error not wrapping ErrInvalidJSON", err)
+			}
+		})
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name                  string
+		rawJson               string
+		disallowUnknownFields bool
+		wantErr               bool
+	}{
+		{"valid", `{"name":"item"}`, false, false},
+		{"unknown field allowed", `{"name":"item","extra":1}`, false, false},
+		{"unknown field disallowed", `{"name":"item","extra":1}`, true, true},
+		{"wrong type", `{"name":1}`, false, true},
+		{"fails validation", `{}`, false, true},
+		{"not json", `name`, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := decodeJSON([]byte(test.rawJson), &testValidateItem{}, test.disallowUnknownFields)
+
+			if test.wantErr && !errors.Is(err, ErrInvalidJSON) {
+				t.Fatalf("got %v, want ErrInvalidJSON", err)
+			}
+
+			if !test.wantErr && err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package nexproto
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 
 	nex "github.com/ihatecompvir/nex-go"
@@ -15,12 +17,28 @@ const (
 	JsonRequest2 = 0x2 // used for telemetry and other things that are not crucial to the game functioning
 )
 
+// DefaultMaxJSONResponseSize is the default largest JSON response RespondJSON will send.
+// Responses larger than a PRUDP packet, e.g. leaderboards and setlists, are split into fragments by the server when sent
+const DefaultMaxJSONResponseSize = 256 * 1024
+
 // JsonProtocol handles the Json requests
 type JsonProtocol struct {
 	server              *nex.Server
 	ConnectionIDCounter *nex.Counter
 	JSONRequestHandler  func(err error, client *nex.Client, callID uint32, rawJson string)
 	JSONRequest2Handler func(err error, client *nex.Client, callID uint32, rawJson string)
+
+	// MaxJSONResponseSize is the largest JSON response RespondJSON will send, 0 for no limit
+	MaxJSONResponseSize int
+
+	// Telemetry handles JsonRequest2 when no JSONRequest2Handler is set
+	Telemetry *TelemetryPipeline
+
+	// MaxJSONRequestSize and MaxJSONDepth limit the JSON of incoming requests, 0 for no limit.
+	// When either is set, requests over a limit or which aren't valid JSON are answered with CoreInvalidArgument
+	// and never reach the handler. JsonRequest2 calls answered by Telemetry are never checked, so they are always acknowledged
+	MaxJSONRequestSize int
+	MaxJSONDepth       int
 }
 
 // Setup initializes the protocol
@@ -80,11 +98,23 @@ func (jsonProtocol *JsonProtocol) handleRequest(packet nex.PacketInterface) {
 		return
 	}
 
+	if err := checkJSONLimits(rawJson, jsonProtocol.MaxJSONRequestSize, jsonProtocol.MaxJSONDepth); err != nil {
+		log.Println("[JsonProtocol::JSONRequest]", err)
+		respondErrorCode(client, JsonProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
 	go jsonProtocol.JSONRequestHandler(nil, client, callID, rawJson)
 }
 
 func (jsonProtocol *JsonProtocol) handleRequest2(packet nex.PacketInterface) {
-	if jsonProtocol.JSONRequestHandler == nil {
+	handler := jsonProtocol.JSONRequest2Handler
+
+	if handler == nil && jsonProtocol.Telemetry != nil {
+		handler = jsonProtocol.Telemetry.HandleJSONRequest2
+	}
+
+	if handler == nil {
 		log.Println("[Warning] JsonProtocol::JSONRequest2 not implemented")
 		go respondNotImplemented(packet, JsonProtocolID)
 		return
@@ -100,18 +130,62 @@ func (jsonProtocol *JsonProtocol) handleRequest2(packet nex.PacketInterface) {
 
 	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
 		err := errors.New("[JsonProtocol::JSONRequest2] Json missing length")
-		go jsonProtocol.JSONRequest2Handler(err, client, callID, "")
+		go handler(err, client, callID, "")
 		return
 	}
 
 	rawJson, err := parametersStream.Read4ByteString()
 
 	if err != nil {
-		go jsonProtocol.JSONRequest2Handler(nil, client, callID, "[]")
+		go handler(err, client, callID, "")
 		return
 	}
 
-	go jsonProtocol.JSONRequest2Handler(nil, client, callID, rawJson)
+	// the telemetry pipeline acknowledges every request and skips the events it can't parse itself
+	if jsonProtocol.JSONRequest2Handler != nil {
+		if err := checkJSONLimits(rawJson, jsonProtocol.MaxJSONRequestSize, jsonProtocol.MaxJSONDepth); err != nil {
+			log.Println("[JsonProtocol::JSONRequest2]", err)
+			respondErrorCode(client, JsonProtocolID, callID, ResultCodeCoreInvalidArgument)
+			return
+		}
+	}
+
+	go handler(nil, client, callID, rawJson)
+}
+
+// RespondJSON marshals v and sends it as the response to a JsonRequest or JsonRequest2 call.
+// The JSON is written as a 4 byte length string, the same encoding the requests use.
+// Responses larger than a PRUDP packet are split into fragments by the server when sent.
+// If v can't be encoded or is larger than MaxJSONResponseSize an error response is sent and the error returned
+func (jsonProtocol *JsonProtocol) RespondJSON(client *nex.Client, callID uint32, methodID uint32, v any) error {
+	rawJson, err := jsonProtocol.encodeJSONResponse(v)
+
+	if err != nil {
+		respondErrorCode(client, JsonProtocolID, callID, ResultCodeCoreUnknown)
+		return err
+	}
+
+	rmcResponseStream := NewStreamOut(jsonProtocol.server)
+	rmcResponseStream.Write4ByteString(string(rawJson))
+
+	respondSuccess(client, JsonProtocolID, callID, methodID, rmcResponseStream.Bytes())
+
+	return nil
+}
+
+// encodeJSONResponse marshals the JSON of a response, checking it against MaxJSONResponseSize
+func (jsonProtocol *JsonProtocol) encodeJSONResponse(v any) ([]byte, error) {
+	rawJson, err := json.Marshal(v)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if jsonProtocol.MaxJSONResponseSize > 0 && len(rawJson) > jsonProtocol.MaxJSONResponseSize {
+		return nil, fmt.Errorf("[JsonProtocol::RespondJSON] Response of %d bytes is larger than %d", len(rawJson), jsonProtocol.MaxJSONResponseSize)
+	}
+
+	return rawJson, nil
 }
 
 // NewJsonProtocol returns a new JsonProtocol
@@ -119,6 +193,7 @@ func NewJsonProtocol(server *nex.Server) *JsonProtocol {
 	jsonProtocol := &JsonProtocol{
 		server:              server,
 		ConnectionIDCounter: nex.NewCounter(10),
+		MaxJSONResponseSize: DefaultMaxJSONResponseSize,
 	}
 
 	jsonProtocol.Setup()
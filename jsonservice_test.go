@@ -0,0 +1,82 @@
+package nexproto
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+type testLeaderboardEntry struct {
+	Rank  int    `json:"rank"`
+	Name  string `json:"name"`
+	Score int    `json:"score"`
+}
+
+func testLeaderboard(entries int) []testLeaderboardEntry {
+	leaderboard := make([]testLeaderboardEntry, 0, entries)
+
+	for i := 0; i < entries; i++ {
+		leaderboard = append(leaderboard, testLeaderboardEntry{Rank: i + 1, Name: fmt.Sprintf("Band %d", i), Score: 1000000 - i})
+	}
+
+	return leaderboard
+}
+
+func TestJsonProtocolEncodeJSONResponse(t *testing.T) {
+	// a leaderboard spanning many PRUDP packets, which are around 1300 bytes
+	leaderboard := testLeaderboard(500)
+
+	tests := []struct {
+		name                string
+		maxJSONResponseSize int
+		v                   any
+		wantErr             bool
+	}{
+		{"leaderboard under the default limit", DefaultMaxJSONResponseSize, leaderboard, false},
+		{"no limit", 0, leaderboard, false},
+		{"over the limit", 1024, leaderboard, true},
+		{"small response", 1024, map[string]int{"rank": 1}, false},
+		{"not encodable", 0, math.Inf(1), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			jsonProtocol := &JsonProtocol{MaxJSONResponseSize: test.maxJSONResponseSize}
+
+			rawJson, err := jsonProtocol.encodeJSONResponse(test.v)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected, err := json.Marshal(test.v)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(rawJson) != string(expected) {
+				t.Fatal("response JSON differs from the encoded value")
+			}
+		})
+	}
+
+	rawJson, err := (&JsonProtocol{MaxJSONResponseSize: DefaultMaxJSONResponseSize}).encodeJSONResponse(leaderboard)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rawJson) < 10*1300 {
+		t.Fatalf("leaderboard is only %d bytes, the test needs a response spanning many packets", len(rawJson))
+	}
+}
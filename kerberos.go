@@ -0,0 +1,227 @@
+package nexproto
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// KerberosTicketInternalData holds the part of a ticket which only the target server can read
+type KerberosTicketInternalData struct {
+	Expiration time.Time
+	UserPID    uint32
+	SessionKey []byte
+}
+
+// Encrypt encodes the internal data and encrypts it with the target server key
+func (internalData *KerberosTicketInternalData) Encrypt(key []byte) ([]byte, error) {
+	data := make([]byte, 12, 12+len(internalData.SessionKey))
+
+	binary.LittleEndian.PutUint64(data[0:8], kerberosDateTime(internalData.Expiration))
+	binary.LittleEndian.PutUint32(data[8:12], internalData.UserPID)
+	data = append(data, internalData.SessionKey...)
+
+	return kerberosEncrypt(key, data)
+}
+
+// Expired checks if the ticket is no longer valid at the given time
+func (internalData *KerberosTicketInternalData) Expired(now time.Time) bool {
+	return !now.Before(internalData.Expiration)
+}
+
+// DecryptKerberosTicketInternalData decrypts and decodes ticket internal data using the target server key
+func DecryptKerberosTicketInternalData(encrypted []byte, key []byte, keySize int) (*KerberosTicketInternalData, error) {
+	data, err := kerberosDecrypt(key, encrypted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != 12+keySize {
+		return nil, errors.New("[KerberosTicketInternalData::Decrypt] Data size does not match key size")
+	}
+
+	internalData := &KerberosTicketInternalData{
+		Expiration: kerberosTime(binary.LittleEndian.Uint64(data[0:8])),
+		UserPID:    binary.LittleEndian.Uint32(data[8:12]),
+		SessionKey: data[12:],
+	}
+
+	return internalData, nil
+}
+
+// KerberosTicket holds the ticket given to a user, readable with the user key
+type KerberosTicket struct {
+	SessionKey   []byte
+	TargetPID    uint32
+	InternalData []byte
+}
+
+// Encrypt encodes the ticket and encrypts it with the user key
+func (ticket *KerberosTicket) Encrypt(key []byte) ([]byte, error) {
+	data := make([]byte, 0, len(ticket.SessionKey)+8+len(ticket.InternalData))
+
+	data = append(data, ticket.SessionKey...)
+	data = binary.LittleEndian.AppendUint32(data, ticket.TargetPID)
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(ticket.InternalData)))
+	data = append(data, ticket.InternalData...)
+
+	return kerberosEncrypt(key, data)
+}
+
+// DecryptKerberosTicket decrypts and decodes a ticket using the user key
+func DecryptKerberosTicket(encrypted []byte, key []byte, keySize int) (*KerberosTicket, error) {
+	data, err := kerberosDecrypt(key, encrypted)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < keySize+8 {
+		return nil, errors.New("[KerberosTicket::Decrypt] Data size too small")
+	}
+
+	internalDataLength := binary.LittleEndian.Uint32(data[keySize+4 : keySize+8])
+
+	if uint32(len(data)-keySize-8) != internalDataLength {
+		return nil, errors.New("[KerberosTicket::Decrypt] Internal data length does not match")
+	}
+
+	ticket := &KerberosTicket{
+		SessionKey:   data[:keySize],
+		TargetPID:    binary.LittleEndian.Uint32(data[keySize : keySize+4]),
+		InternalData: data[keySize+8:],
+	}
+
+	return ticket, nil
+}
+
+// BuildKerberosTicket creates a ticket granting userPID access to targetPID for the given lifetime.
+// The returned ticket is encrypted with userKey, and the returned internal data is what the target server will see
+func BuildKerberosTicket(userPID uint32, userKey []byte, targetPID uint32, targetKey []byte, keySize int, lifetime time.Duration) ([]byte, *KerberosTicketInternalData, error) {
+	sessionKey, err := NewKerberosSessionKey(keySize)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	internalData := &KerberosTicketInternalData{
+		Expiration: time.Now().Add(lifetime),
+		UserPID:    userPID,
+		SessionKey: sessionKey,
+	}
+
+	encryptedInternalData, err := internalData.Encrypt(targetKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ticket := &KerberosTicket{
+		SessionKey:   sessionKey,
+		TargetPID:    targetPID,
+		InternalData: encryptedInternalData,
+	}
+
+	encryptedTicket, err := ticket.Encrypt(userKey)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encryptedTicket, internalData, nil
+}
+
+// DeriveKerberosKey derives the Kerberos key of a principal from its PID and password
+func DeriveKerberosKey(pid uint32, password []byte) []byte {
+	key := password
+
+	for i := 0; i < 65000+int(pid%1024); i++ {
+		hash := md5.Sum(key)
+		key = hash[:]
+	}
+
+	return key
+}
+
+// NewKerberosSessionKey returns a random session key of the given size
+func NewKerberosSessionKey(keySize int) ([]byte, error) {
+	sessionKey := make([]byte, keySize)
+
+	if _, err := rand.Read(sessionKey); err != nil {
+		return nil, err
+	}
+
+	return sessionKey, nil
+}
+
+// kerberosEncrypt encrypts data the same way as nex.KerberosEncryption, RC4 followed by an HMAC-MD5 checksum
+func kerberosEncrypt(key []byte, data []byte) ([]byte, error) {
+	cipher, err := rc4.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := make([]byte, len(data), len(data)+md5.Size)
+	cipher.XORKeyStream(encrypted, data)
+
+	mac := hmac.New(md5.New, key)
+	mac.Write(encrypted)
+
+	return mac.Sum(encrypted), nil
+}
+
+func kerberosDecrypt(key []byte, data []byte) ([]byte, error) {
+	if len(data) < md5.Size {
+		return nil, errors.New("[Kerberos::Decrypt] Data size too small")
+	}
+
+	encrypted := data[:len(data)-md5.Size]
+	checksum := data[len(data)-md5.Size:]
+
+	mac := hmac.New(md5.New, key)
+	mac.Write(encrypted)
+
+	if !hmac.Equal(checksum, mac.Sum(nil)) {
+		return nil, errors.New("[Kerberos::Decrypt] Checksum does not match")
+	}
+
+	cipher, err := rc4.NewCipher(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make([]byte, len(encrypted))
+	cipher.XORKeyStream(decrypted, encrypted)
+
+	return decrypted, nil
+}
+
+// kerberosDateTime converts a time to the NEX DateTime format used for ticket expiry
+func kerberosDateTime(t time.Time) uint64 {
+	t = t.UTC()
+
+	return uint64(t.Second()) |
+		uint64(t.Minute())<<6 |
+		uint64(t.Hour())<<12 |
+		uint64(t.Day())<<17 |
+		uint64(t.Month())<<22 |
+		uint64(t.Year())<<26
+}
+
+func kerberosTime(dateTime uint64) time.Time {
+	second := int(dateTime & 63)
+	minute := int((dateTime >> 6) & 63)
+	hour := int((dateTime >> 12) & 31)
+	day := int((dateTime >> 17) & 31)
+	month := time.Month((dateTime >> 22) & 15)
+	year := int(dateTime >> 26)
+
+	return time.Date(year, month, day, hour, minute, second, 0, time.UTC)
+}
@@ -0,0 +1,148 @@
+package nexproto
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestKerberosEncryptRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+		data []byte
+	}{
+		{"empty data", []byte("key"), []byte{}},
+		{"short key", []byte{1}, []byte("hello")},
+		{"derived key", DeriveKerberosKey(1234, []byte("password")), bytes.Repeat([]byte{0xAB}, 100)},
+		{"max key", bytes.Repeat([]byte{7}, 256), []byte("hello")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encrypted, err := kerberosEncrypt(test.key, test.data)
+
+			if err != nil {
+				t.Fatalf("encrypt: %v", err)
+			}
+
+			decrypted, err := kerberosDecrypt(test.key, encrypted)
+
+			if err != nil {
+				t.Fatalf("decrypt: %v", err)
+			}
+
+			if !bytes.Equal(decrypted, test.data) {
+				t.Fatalf("got %x, want %x", decrypted, test.data)
+			}
+		})
+	}
+}
+
+func TestKerberosEncryptInvalidKey(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"empty key", []byte{}},
+		{"key too long", bytes.Repeat([]byte{7}, 257)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := kerberosEncrypt(test.key, []byte("hello")); err == nil {
+				t.Fatal("expected an error")
+			}
+
+			internalData := &KerberosTicketInternalData{Expiration: time.Now(), UserPID: 1, SessionKey: make([]byte, 16)}
+
+			if _, err := internalData.Encrypt(test.key); err == nil {
+				t.Fatal("expected an error from KerberosTicketInternalData.Encrypt")
+			}
+
+			if _, _, err := BuildKerberosTicket(1, test.key, 2, []byte("server"), 16, time.Hour); err == nil {
+				t.Fatal("expected an error from BuildKerberosTicket")
+			}
+		})
+	}
+}
+
+func TestKerberosDecryptRejectsTampering(t *testing.T) {
+	key := []byte("key")
+	encrypted, err := kerberosEncrypt(key, []byte("hello world"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		key  []byte
+		data func() []byte
+	}{
+		{"flipped data byte", key, func() []byte {
+			data := bytes.Clone(encrypted)
+			data[0] ^= 1
+			return data
+		}},
+		{"flipped checksum byte", key, func() []byte {
+			data := bytes.Clone(encrypted)
+			data[len(data)-1] ^= 1
+			return data
+		}},
+		{"truncated", key, func() []byte { return encrypted[:10] }},
+		{"wrong key", []byte("other key"), func() []byte { return encrypted }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := kerberosDecrypt(test.key, test.data()); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+func TestBuildKerberosTicketRoundTrip(t *testing.T) {
+	userKey := DeriveKerberosKey(1234, []byte("password"))
+	serverKey := DeriveKerberosKey(2, []byte("server password"))
+
+	encryptedTicket, internalData, err := BuildKerberosTicket(1234, userKey, 2, serverKey, 16, time.Hour)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ticket, err := DecryptKerberosTicket(encryptedTicket, userKey, 16)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ticket.TargetPID != 2 || !bytes.Equal(ticket.SessionKey, internalData.SessionKey) {
+		t.Fatalf("unexpected ticket %+v", ticket)
+	}
+
+	if _, err := DecryptKerberosTicket(encryptedTicket, serverKey, 16); err == nil {
+		t.Fatal("expected the server key to be rejected for the user ticket")
+	}
+
+	decryptedInternalData, err := DecryptKerberosTicketInternalData(ticket.InternalData, serverKey, 16)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decryptedInternalData.UserPID != 1234 || !bytes.Equal(decryptedInternalData.SessionKey, internalData.SessionKey) {
+		t.Fatalf("unexpected internal data %+v", decryptedInternalData)
+	}
+
+	// the NEX DateTime format only has second precision
+	if !decryptedInternalData.Expiration.Equal(internalData.Expiration.UTC().Truncate(time.Second)) {
+		t.Fatalf("got expiration %v, want %v", decryptedInternalData.Expiration, internalData.Expiration)
+	}
+
+	if _, err := DecryptKerberosTicketInternalData(ticket.InternalData, userKey, 16); err == nil {
+		t.Fatal("expected the user key to be rejected for the internal data")
+	}
+}
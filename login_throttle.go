@@ -0,0 +1,205 @@
+package nexproto
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrLoginBackoff is returned while an address or username has to wait before trying again
+	ErrLoginBackoff = errors.New("[LoginThrottle] Too many failed login attempts, try again later")
+
+	// ErrLoginLockedOut is returned while an address or username is locked out
+	ErrLoginLockedOut = errors.New("[LoginThrottle] Locked out after too many failed login attempts")
+)
+
+type loginThrottleEntry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+	lockedOut    bool
+}
+
+// LoginThrottle tracks failed login attempts per address, per address and username, and per username when ThrottleUsernames is set.
+// After MaxFailures failures every further attempt has to wait an exponentially growing backoff,
+// and after LockoutFailures failures the address or username is locked out for LockoutDuration.
+// Failures are forgotten once ResetAfter has passed without a new one, use StartLoginThrottleCleanup to drop them
+type LoginThrottle struct {
+	MaxFailures     int
+	BaseBackoff     time.Duration
+	MaxBackoff      time.Duration
+	LockoutFailures int
+	LockoutDuration time.Duration
+	ResetAfter      time.Duration
+
+	// ThrottleUsernames also counts failures per username no matter which address they come from.
+	// This slows down attacks spread over many addresses, but lets anyone lock any account out
+	ThrottleUsernames bool
+
+	mutex   sync.Mutex
+	entries map[string]*loginThrottleEntry
+}
+
+// Check returns ErrLoginBackoff or ErrLoginLockedOut if a login from address for username must be refused
+func (loginThrottle *LoginThrottle) Check(address string, username string) error {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+
+	now := time.Now()
+
+	for _, key := range loginThrottle.keys(address, username) {
+		entry := loginThrottle.entry(key, now, false)
+
+		if entry == nil || !now.Before(entry.blockedUntil) {
+			continue
+		}
+
+		if entry.lockedOut {
+			return ErrLoginLockedOut
+		}
+
+		return ErrLoginBackoff
+	}
+
+	return nil
+}
+
+// RecordFailure records a failed login from address for username
+func (loginThrottle *LoginThrottle) RecordFailure(address string, username string) {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+
+	now := time.Now()
+
+	for _, key := range loginThrottle.keys(address, username) {
+		entry := loginThrottle.entry(key, now, true)
+
+		entry.failures++
+		entry.lastFailure = now
+
+		if loginThrottle.LockoutFailures > 0 && entry.failures >= loginThrottle.LockoutFailures {
+			entry.lockedOut = true
+			entry.blockedUntil = now.Add(loginThrottle.LockoutDuration)
+		} else if entry.failures > loginThrottle.MaxFailures {
+			entry.blockedUntil = now.Add(loginThrottle.backoff(entry.failures - loginThrottle.MaxFailures))
+		}
+	}
+}
+
+// RecordSuccess forgets the failed logins for username. The failures counted for the whole address are kept,
+// so logging into one account doesn't reset the backoff of guesses against other accounts
+func (loginThrottle *LoginThrottle) RecordSuccess(address string, username string) {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+
+	for _, key := range loginThrottle.keys(address, username)[1:] {
+		delete(loginThrottle.entries, key)
+	}
+}
+
+// Cleanup forgets every address and username which is no longer blocked and has not failed for ResetAfter
+func (loginThrottle *LoginThrottle) Cleanup(now time.Time) {
+	loginThrottle.mutex.Lock()
+	defer loginThrottle.mutex.Unlock()
+
+	for key := range loginThrottle.entries {
+		loginThrottle.entry(key, now, false)
+	}
+}
+
+// entry returns the entry for key, dropping it first if it is stale. Must be called with mutex held
+func (loginThrottle *LoginThrottle) entry(key string, now time.Time, create bool) *loginThrottleEntry {
+	entry, ok := loginThrottle.entries[key]
+
+	if ok && !now.Before(entry.blockedUntil) && now.Sub(entry.lastFailure) >= loginThrottle.ResetAfter {
+		delete(loginThrottle.entries, key)
+		ok = false
+	}
+
+	if ok && entry.lockedOut && !now.Before(entry.blockedUntil) {
+		// lockout served, start counting again
+		delete(loginThrottle.entries, key)
+		ok = false
+	}
+
+	if !ok && create {
+		if loginThrottle.entries == nil {
+			loginThrottle.entries = make(map[string]*loginThrottleEntry)
+		}
+
+		entry = &loginThrottleEntry{}
+		loginThrottle.entries[key] = entry
+		ok = true
+	}
+
+	if !ok {
+		return nil
+	}
+
+	return entry
+}
+
+func (loginThrottle *LoginThrottle) backoff(excessFailures int) time.Duration {
+	backoff := loginThrottle.BaseBackoff
+
+	for i := 1; i < excessFailures && backoff < loginThrottle.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > loginThrottle.MaxBackoff {
+		backoff = loginThrottle.MaxBackoff
+	}
+
+	return backoff
+}
+
+// keys returns the keys failures from address for username are counted under, the address alone first
+func (loginThrottle *LoginThrottle) keys(address string, username string) []string {
+	keys := []string{"address:" + address, "address:" + address + "|username:" + username}
+
+	if loginThrottle.ThrottleUsernames {
+		keys = append(keys, "username:"+username)
+	}
+
+	return keys
+}
+
+// NewLoginThrottle returns a new LoginThrottle with default limits
+func NewLoginThrottle() *LoginThrottle {
+	return &LoginThrottle{
+		MaxFailures:     3,
+		BaseBackoff:     time.Second,
+		MaxBackoff:      time.Minute,
+		LockoutFailures: 10,
+		LockoutDuration: 15 * time.Minute,
+		ResetAfter:      15 * time.Minute,
+		entries:         make(map[string]*loginThrottleEntry),
+	}
+}
+
+// StartLoginThrottleCleanup periodically calls Cleanup on a LoginThrottle until the returned function is called
+func StartLoginThrottleCleanup(loginThrottle *LoginThrottle, interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				loginThrottle.Cleanup(now)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package nexproto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLoginThrottle() *LoginThrottle {
+	loginThrottle := NewLoginThrottle()
+	loginThrottle.MaxFailures = 2
+	loginThrottle.BaseBackoff = time.Hour
+	loginThrottle.MaxBackoff = 4 * time.Hour
+	loginThrottle.LockoutFailures = 5
+	loginThrottle.LockoutDuration = 24 * time.Hour
+	loginThrottle.ResetAfter = 24 * time.Hour
+
+	return loginThrottle
+}
+
+func recordLoginFailures(loginThrottle *LoginThrottle, address string, username string, failures int) {
+	for i := 0; i < failures; i++ {
+		loginThrottle.RecordFailure(address, username)
+	}
+}
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		err      error
+	}{
+		{"no failures", 0, nil},
+		{"up to MaxFailures", 2, nil},
+		{"over MaxFailures", 3, ErrLoginBackoff},
+		{"just under LockoutFailures", 4, ErrLoginBackoff},
+		{"LockoutFailures", 5, ErrLoginLockedOut},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loginThrottle := newTestLoginThrottle()
+			recordLoginFailures(loginThrottle, "10.0.0.1", "alice", test.failures)
+
+			if err := loginThrottle.Check("10.0.0.1", "alice"); !errors.Is(err, test.err) {
+				t.Fatalf("got %v, want %v", err, test.err)
+			}
+
+			// failures are counted for the whole address
+			if err := loginThrottle.Check("10.0.0.1", "bob"); !errors.Is(err, test.err) {
+				t.Fatalf("other username: got %v, want %v", err, test.err)
+			}
+
+			if err := loginThrottle.Check("10.0.0.2", "alice"); err != nil {
+				t.Fatalf("other address: got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestLoginThrottleBackoffGrowth(t *testing.T) {
+	loginThrottle := newTestLoginThrottle()
+
+	tests := []struct {
+		excessFailures int
+		backoff        time.Duration
+	}{
+		{1, time.Hour},
+		{2, 2 * time.Hour},
+		{3, 4 * time.Hour},
+		{10, 4 * time.Hour},
+	}
+
+	for _, test := range tests {
+		if backoff := loginThrottle.backoff(test.excessFailures); backoff != test.backoff {
+			t.Fatalf("%d excess failures: got %v, want %v", test.excessFailures, backoff, test.backoff)
+		}
+	}
+}
+
+func TestLoginThrottleReset(t *testing.T) {
+	loginThrottle := newTestLoginThrottle()
+	loginThrottle.BaseBackoff = time.Millisecond
+	loginThrottle.MaxBackoff = time.Millisecond
+	loginThrottle.ResetAfter = 10 * time.Millisecond
+
+	recordLoginFailures(loginThrottle, "10.0.0.1", "alice", 3)
+
+	if err := loginThrottle.Check("10.0.0.1", "alice"); !errors.Is(err, ErrLoginBackoff) {
+		t.Fatalf("got %v, want ErrLoginBackoff", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if err := loginThrottle.Check("10.0.0.1", "alice"); err != nil {
+		t.Fatalf("got %v after ResetAfter, want no error", err)
+	}
+
+	// the failures were forgotten, so one more is not enough for a backoff
+	loginThrottle.RecordFailure("10.0.0.1", "alice")
+
+	if err := loginThrottle.Check("10.0.0.1", "alice"); err != nil {
+		t.Fatalf("got %v, want the count to have restarted", err)
+	}
+
+	loginThrottle.Cleanup(time.Now().Add(time.Hour))
+
+	if len(loginThrottle.entries) != 0 {
+		t.Fatalf("got %d entries after Cleanup, want 0", len(loginThrottle.entries))
+	}
+}
+
+func TestLoginThrottleSuccessDoesNotResetAddress(t *testing.T) {
+	loginThrottle := newTestLoginThrottle()
+
+	// guesses against a victim interleaved with logins to an account the attacker owns
+	for i := 0; i < 3; i++ {
+		loginThrottle.RecordFailure("10.0.0.1", "victim")
+		loginThrottle.RecordSuccess("10.0.0.1", "attacker")
+	}
+
+	if err := loginThrottle.Check("10.0.0.1", "victim"); !errors.Is(err, ErrLoginBackoff) {
+		t.Fatalf("got %v, want ErrLoginBackoff", err)
+	}
+
+	recordLoginFailures(loginThrottle, "10.0.0.1", "victim", 2)
+	loginThrottle.RecordSuccess("10.0.0.1", "victim")
+
+	if err := loginThrottle.Check("10.0.0.1", "victim"); !errors.Is(err, ErrLoginLockedOut) {
+		t.Fatalf("got %v, want ErrLoginLockedOut", err)
+	}
+}
+
+func TestLoginThrottleSuccessResetsUsername(t *testing.T) {
+	loginThrottle := newTestLoginThrottle()
+	loginThrottle.ThrottleUsernames = true
+
+	// failures against one username spread over several addresses
+	loginThrottle.RecordFailure("10.0.0.1", "alice")
+	loginThrottle.RecordFailure("10.0.0.2", "alice")
+	loginThrottle.RecordFailure("10.0.0.3", "alice")
+
+	if err := loginThrottle.Check("10.0.0.4", "alice"); !errors.Is(err, ErrLoginBackoff) {
+		t.Fatalf("got %v, want ErrLoginBackoff for the username", err)
+	}
+
+	loginThrottle.RecordSuccess("10.0.0.5", "alice")
+
+	if err := loginThrottle.Check("10.0.0.4", "alice"); err != nil {
+		t.Fatalf("got %v, want the username to be reset", err)
+	}
+}
+
+func TestStartLoginThrottleCleanup(t *testing.T) {
+	loginThrottle := newTestLoginThrottle()
+	loginThrottle.ResetAfter = time.Millisecond
+	loginThrottle.RecordFailure("10.0.0.1", "alice")
+
+	stop := StartLoginThrottleCleanup(loginThrottle, 5*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		loginThrottle.mutex.Lock()
+		entries := len(loginThrottle.entries)
+		loginThrottle.mutex.Unlock()
+
+		if entries == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("stale entries were not cleaned up")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// stopping twice must not panic
+	stop()
+}
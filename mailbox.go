@@ -0,0 +1,287 @@
+package nexproto
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	nex "github.com/ihatecompvir/nex-go"
+)
+
+// ErrMailboxFull is returned by a MemoryMailbox when a message would open an inbox beyond MaxInboxes
+var ErrMailboxFull = errors.New("[Mailbox] Too many inboxes")
+
+const (
+	// DefaultMailboxMaxInboxes is the number of inboxes a MemoryMailbox holds at most by default
+	DefaultMailboxMaxInboxes = 100000
+
+	// DefaultMailboxMaxPageSize is the number of messages a MemoryMailbox returns from GetMessages at most by default
+	DefaultMailboxMaxPageSize = 100
+)
+
+// Mailbox stores the messages sent through the Messaging protocol.
+// Every MessageRecipient, player or gathering, has its own inbox ordered from oldest to newest
+type Mailbox interface {
+	DeliverMessage(recipient MessageRecipient, message MessageInterface) (MessageInterface, error)
+	CountMessages(recipient MessageRecipient) (uint32, error)
+	GetMessages(recipient MessageRecipient, resultRange *ResultRange) ([]MessageInterface, error)
+	GetMessagesByID(recipient MessageRecipient, messageIDs []uint32) ([]MessageInterface, error)
+	DeleteMessages(recipient MessageRecipient, messageIDs []uint32) (uint32, error)
+	DeleteAllMessages(recipient MessageRecipient) (uint32, error)
+	CleanupMessages(now time.Time) (int, error)
+}
+
+type mailboxEntry struct {
+	message    MessageInterface
+	receivedAt time.Time
+}
+
+// MemoryMailbox is a Mailbox which keeps messages in memory.
+// Each inbox keeps at most MaxMessages messages, dropping the oldest first, and messages older than MaxAge are dropped.
+// At most MaxInboxes inboxes are kept, and GetMessages returns at most MaxPageSize messages.
+// A value of 0 disables any of these limits
+type MemoryMailbox struct {
+	MaxMessages int
+	MaxAge      time.Duration
+	MaxInboxes  int
+	MaxPageSize int
+
+	mutex         sync.Mutex
+	nextMessageID uint32
+	inboxes       map[MessageRecipient][]*mailboxEntry
+}
+
+// DeliverMessage stores a copy of message in the inbox of recipient, assigning it a message ID and reception time.
+// The stored copy is returned
+func (memoryMailbox *MemoryMailbox) DeliverMessage(recipient MessageRecipient, message MessageInterface) (MessageInterface, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	now := time.Now()
+	inbox := memoryMailbox.inbox(recipient, now)
+
+	if len(inbox) == 0 && memoryMailbox.MaxInboxes > 0 && len(memoryMailbox.inboxes) >= memoryMailbox.MaxInboxes {
+		return nil, ErrMailboxFull
+	}
+
+	delivered := copyMessage(message)
+	header := delivered.Header()
+
+	header.ID = memoryMailbox.nextMessageID
+	header.ReceptionTime = nex.NewDateTime(kerberosDateTime(now))
+	header.Recipient = recipient
+
+	memoryMailbox.nextMessageID++
+
+	inbox = append(inbox, &mailboxEntry{
+		message:    delivered,
+		receivedAt: now,
+	})
+
+	if memoryMailbox.MaxMessages > 0 && len(inbox) > memoryMailbox.MaxMessages {
+		inbox = inbox[len(inbox)-memoryMailbox.MaxMessages:]
+	}
+
+	memoryMailbox.inboxes[recipient] = inbox
+
+	return copyMessage(delivered), nil
+}
+
+// CountMessages returns the number of messages in the inbox of recipient
+func (memoryMailbox *MemoryMailbox) CountMessages(recipient MessageRecipient) (uint32, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	return uint32(len(memoryMailbox.inbox(recipient, time.Now()))), nil
+}
+
+// GetMessages returns the messages of the inbox of recipient within resultRange, oldest first.
+// resultRange.Size is capped to MaxPageSize
+func (memoryMailbox *MemoryMailbox) GetMessages(recipient MessageRecipient, resultRange *ResultRange) ([]MessageInterface, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	inbox := memoryMailbox.inbox(recipient, time.Now())
+	messages := make([]MessageInterface, 0)
+
+	if resultRange.Offset >= uint32(len(inbox)) {
+		return messages, nil
+	}
+
+	inbox = inbox[resultRange.Offset:]
+	size := resultRange.Size
+
+	if memoryMailbox.MaxPageSize > 0 && size > uint32(memoryMailbox.MaxPageSize) {
+		size = uint32(memoryMailbox.MaxPageSize)
+	}
+
+	if size < uint32(len(inbox)) {
+		inbox = inbox[:size]
+	}
+
+	for _, entry := range inbox {
+		messages = append(messages, copyMessage(entry.message))
+	}
+
+	return messages, nil
+}
+
+// GetMessagesByID returns the messages of the inbox of recipient with the given IDs, skipping any which do not exist
+func (memoryMailbox *MemoryMailbox) GetMessagesByID(recipient MessageRecipient, messageIDs []uint32) ([]MessageInterface, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	wanted := make(map[uint32]bool, len(messageIDs))
+
+	for _, messageID := range messageIDs {
+		wanted[messageID] = true
+	}
+
+	messages := make([]MessageInterface, 0)
+
+	for _, entry := range memoryMailbox.inbox(recipient, time.Now()) {
+		if wanted[entry.message.Header().ID] {
+			messages = append(messages, copyMessage(entry.message))
+		}
+	}
+
+	return messages, nil
+}
+
+// DeleteMessages removes the messages with the given IDs from the inbox of recipient, returning how many were removed
+func (memoryMailbox *MemoryMailbox) DeleteMessages(recipient MessageRecipient, messageIDs []uint32) (uint32, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	unwanted := make(map[uint32]bool, len(messageIDs))
+
+	for _, messageID := range messageIDs {
+		unwanted[messageID] = true
+	}
+
+	inbox := memoryMailbox.inbox(recipient, time.Now())
+	kept := make([]*mailboxEntry, 0, len(inbox))
+
+	for _, entry := range inbox {
+		if !unwanted[entry.message.Header().ID] {
+			kept = append(kept, entry)
+		}
+	}
+
+	memoryMailbox.setInbox(recipient, kept)
+
+	return uint32(len(inbox) - len(kept)), nil
+}
+
+// DeleteAllMessages empties the inbox of recipient, returning how many messages were removed
+func (memoryMailbox *MemoryMailbox) DeleteAllMessages(recipient MessageRecipient) (uint32, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	removed := len(memoryMailbox.inbox(recipient, time.Now()))
+	delete(memoryMailbox.inboxes, recipient)
+
+	return uint32(removed), nil
+}
+
+// CleanupMessages removes every message older than MaxAge from every inbox, returning how many were removed
+func (memoryMailbox *MemoryMailbox) CleanupMessages(now time.Time) (int, error) {
+	memoryMailbox.mutex.Lock()
+	defer memoryMailbox.mutex.Unlock()
+
+	removed := 0
+
+	for recipient, inbox := range memoryMailbox.inboxes {
+		removed += len(inbox) - len(memoryMailbox.inbox(recipient, now))
+	}
+
+	return removed, nil
+}
+
+// inbox returns the inbox of recipient after dropping expired messages. Must be called with mutex held
+func (memoryMailbox *MemoryMailbox) inbox(recipient MessageRecipient, now time.Time) []*mailboxEntry {
+	inbox := memoryMailbox.inboxes[recipient]
+
+	if memoryMailbox.MaxAge <= 0 {
+		return inbox
+	}
+
+	// entries are in delivery order, so the expired ones are all at the start
+	expired := sort.Search(len(inbox), func(i int) bool {
+		return now.Sub(inbox[i].receivedAt) < memoryMailbox.MaxAge
+	})
+
+	if expired > 0 {
+		inbox = inbox[expired:]
+		memoryMailbox.setInbox(recipient, inbox)
+	}
+
+	return inbox
+}
+
+// setInbox replaces the inbox of recipient. Must be called with mutex held
+func (memoryMailbox *MemoryMailbox) setInbox(recipient MessageRecipient, inbox []*mailboxEntry) {
+	if len(inbox) == 0 {
+		delete(memoryMailbox.inboxes, recipient)
+		return
+	}
+
+	memoryMailbox.inboxes[recipient] = inbox
+}
+
+// NewMemoryMailbox returns a new MemoryMailbox with the given retention limits and the default inbox and page limits
+func NewMemoryMailbox(maxMessages int, maxAge time.Duration) *MemoryMailbox {
+	return &MemoryMailbox{
+		MaxMessages:   maxMessages,
+		MaxAge:        maxAge,
+		MaxInboxes:    DefaultMailboxMaxInboxes,
+		MaxPageSize:   DefaultMailboxMaxPageSize,
+		nextMessageID: 1,
+		inboxes:       make(map[MessageRecipient][]*mailboxEntry),
+	}
+}
+
+// StartMailboxCleanup periodically removes expired messages from a Mailbox until the returned function is called
+func StartMailboxCleanup(mailbox Mailbox, interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				_, _ = mailbox.CleanupMessages(now)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// copyMessage returns a copy of a message so stored messages can't be changed by the caller
+func copyMessage(message MessageInterface) MessageInterface {
+	switch message := message.(type) {
+	case *UserMessage:
+		messageCopy := *message
+		return &messageCopy
+	case *TextMessage:
+		messageCopy := *message
+		return &messageCopy
+	case *BinaryMessage:
+		messageCopy := *message
+		messageCopy.BinaryBody = append([]byte(nil), message.BinaryBody...)
+		return &messageCopy
+	default:
+		return message
+	}
+}
@@ -0,0 +1,212 @@
+package nexproto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	testPlayerRecipient    = MessageRecipient{ID: 1000, RecipientType: MessageRecipientTypePID}
+	testGatheringRecipient = MessageRecipient{ID: 50, RecipientType: MessageRecipientTypeGathering}
+)
+
+func deliverTestMessages(t *testing.T, memoryMailbox *MemoryMailbox, recipient MessageRecipient, count int) []uint32 {
+	t.Helper()
+
+	messageIDs := make([]uint32, 0, count)
+
+	for i := 0; i < count; i++ {
+		delivered, err := memoryMailbox.DeliverMessage(recipient, &TextMessage{UserMessage: UserMessage{Subject: "hello"}, TextBody: "body"})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		messageIDs = append(messageIDs, delivered.Header().ID)
+	}
+
+	return messageIDs
+}
+
+func TestMemoryMailboxDeliver(t *testing.T) {
+	memoryMailbox := NewMemoryMailbox(0, 0)
+	message := &TextMessage{UserMessage: UserMessage{Subject: "hello", Recipient: testGatheringRecipient}, TextBody: "body"}
+
+	delivered, err := memoryMailbox.DeliverMessage(testPlayerRecipient, message)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := delivered.Header()
+
+	if header.ID == 0 || header.Recipient != testPlayerRecipient {
+		t.Fatalf("unexpected delivered header %+v", header)
+	}
+
+	// the stored message must not change through the caller's copies
+	message.TextBody = "changed"
+	delivered.(*TextMessage).TextBody = "changed"
+
+	messages, err := memoryMailbox.GetMessagesByID(testPlayerRecipient, []uint32{header.ID})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(messages) != 1 || messages[0].(*TextMessage).TextBody != "body" {
+		t.Fatalf("unexpected stored messages %+v", messages)
+	}
+
+	if count, err := memoryMailbox.CountMessages(testGatheringRecipient); err != nil || count != 0 {
+		t.Fatalf("got %d, %v messages for the gathering, want 0", count, err)
+	}
+}
+
+func TestMemoryMailboxGetMessages(t *testing.T) {
+	memoryMailbox := NewMemoryMailbox(0, 0)
+	memoryMailbox.MaxPageSize = 3
+	messageIDs := deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 5)
+
+	tests := []struct {
+		name        string
+		resultRange ResultRange
+		messageIDs  []uint32
+	}{
+		{"first page", ResultRange{Offset: 0, Size: 2}, messageIDs[:2]},
+		{"second page", ResultRange{Offset: 2, Size: 2}, messageIDs[2:4]},
+		{"past the end", ResultRange{Offset: 4, Size: 2}, messageIDs[4:]},
+		{"offset too large", ResultRange{Offset: 5, Size: 2}, nil},
+		{"size capped to MaxPageSize", ResultRange{Offset: 0, Size: 0xFFFFFFFF}, messageIDs[:3]},
+		{"empty page", ResultRange{Offset: 0, Size: 0}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			messages, err := memoryMailbox.GetMessages(testPlayerRecipient, &test.resultRange)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(messages) != len(test.messageIDs) {
+				t.Fatalf("got %d messages, want %d", len(messages), len(test.messageIDs))
+			}
+
+			for i, message := range messages {
+				if message.Header().ID != test.messageIDs[i] {
+					t.Fatalf("message %d: got ID %d, want %d", i, message.Header().ID, test.messageIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryMailboxDelete(t *testing.T) {
+	memoryMailbox := NewMemoryMailbox(0, 0)
+	messageIDs := deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 3)
+	deliverTestMessages(t, memoryMailbox, testGatheringRecipient, 2)
+
+	removed, err := memoryMailbox.DeleteMessages(testPlayerRecipient, []uint32{messageIDs[0], messageIDs[2], 12345})
+
+	if err != nil || removed != 2 {
+		t.Fatalf("got %d removed, %v, want 2", removed, err)
+	}
+
+	// message IDs of another inbox are not removed
+	if removed, err := memoryMailbox.DeleteMessages(testGatheringRecipient, []uint32{messageIDs[1]}); err != nil || removed != 0 {
+		t.Fatalf("got %d removed from the gathering, %v, want 0", removed, err)
+	}
+
+	if removed, err := memoryMailbox.DeleteAllMessages(testGatheringRecipient); err != nil || removed != 2 {
+		t.Fatalf("got %d removed, %v, want 2", removed, err)
+	}
+
+	if count, err := memoryMailbox.CountMessages(testPlayerRecipient); err != nil || count != 1 {
+		t.Fatalf("got %d, %v messages left, want 1", count, err)
+	}
+}
+
+func TestMemoryMailboxLimits(t *testing.T) {
+	t.Run("MaxMessages drops the oldest", func(t *testing.T) {
+		memoryMailbox := NewMemoryMailbox(2, 0)
+		messageIDs := deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 3)
+
+		messages, err := memoryMailbox.GetMessages(testPlayerRecipient, &ResultRange{Offset: 0, Size: 10})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(messages) != 2 || messages[0].Header().ID != messageIDs[1] || messages[1].Header().ID != messageIDs[2] {
+			t.Fatalf("unexpected messages %+v", messages)
+		}
+	})
+
+	t.Run("MaxInboxes", func(t *testing.T) {
+		memoryMailbox := NewMemoryMailbox(0, 0)
+		memoryMailbox.MaxInboxes = 1
+		deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 1)
+
+		if _, err := memoryMailbox.DeliverMessage(testGatheringRecipient, &UserMessage{}); !errors.Is(err, ErrMailboxFull) {
+			t.Fatalf("got %v, want ErrMailboxFull", err)
+		}
+
+		// existing inboxes still take messages
+		deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 1)
+
+		if _, err := memoryMailbox.DeleteAllMessages(testPlayerRecipient); err != nil {
+			t.Fatal(err)
+		}
+
+		deliverTestMessages(t, memoryMailbox, testGatheringRecipient, 1)
+	})
+}
+
+func TestMemoryMailboxCleanup(t *testing.T) {
+	memoryMailbox := NewMemoryMailbox(0, time.Minute)
+	deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 2)
+	deliverTestMessages(t, memoryMailbox, testGatheringRecipient, 1)
+
+	if removed, err := memoryMailbox.CleanupMessages(time.Now()); err != nil || removed != 0 {
+		t.Fatalf("got %d removed, %v, want 0", removed, err)
+	}
+
+	if removed, err := memoryMailbox.CleanupMessages(time.Now().Add(2 * time.Minute)); err != nil || removed != 3 {
+		t.Fatalf("got %d removed, %v, want 3", removed, err)
+	}
+
+	if len(memoryMailbox.inboxes) != 0 {
+		t.Fatalf("got %d inboxes after cleanup, want 0", len(memoryMailbox.inboxes))
+	}
+}
+
+func TestStartMailboxCleanup(t *testing.T) {
+	memoryMailbox := NewMemoryMailbox(0, time.Millisecond)
+	deliverTestMessages(t, memoryMailbox, testPlayerRecipient, 1)
+
+	stop := StartMailboxCleanup(memoryMailbox, 5*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		memoryMailbox.mutex.Lock()
+		inboxes := len(memoryMailbox.inboxes)
+		memoryMailbox.mutex.Unlock()
+
+		if inboxes == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expired messages were not cleaned up")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	// stopping twice must not panic
+	stop()
+}
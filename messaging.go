@@ -1,6 +1,7 @@
 package nexproto
 
 import (
+	"errors"
 	"log"
 
 	nex "github.com/ihatecompvir/nex-go"
@@ -9,13 +10,185 @@ import (
 const (
 	MessagingProtocolID = 0x17
 
-	GetMessageHeaders = 0x3
+	DeliverMessage                 = 0x1
+	GetNumberOfMessages            = 0x2
+	GetMessageHeaders              = 0x3
+	RetrieveAllMessagesWithinRange = 0x4
+	RetrieveMessages               = 0x5
+	DeleteMessages                 = 0x6
+	DeleteAllMessages              = 0x7
+	DeliverMessageMultiTarget      = 0x8
+)
+
+const (
+	// MessageRecipientTypePID is the recipient type of messages sent to a single player
+	MessageRecipientTypePID = 1
+
+	// MessageRecipientTypeGathering is the recipient type of messages sent to everyone in a gathering
+	MessageRecipientTypeGathering = 2
 )
 
 type MessagingProtocol struct {
-	server                   *nex.Server
-	ConnectionIDCounter      *nex.Counter
-	GetMessageHeadersHandler func(err error, client *nex.Client, callID uint32, pid uint32, recipientType uint32, rangeOffset uint32, rangeSize uint32)
+	server                                *nex.Server
+	ConnectionIDCounter                   *nex.Counter
+	DeliverMessageHandler                 func(err error, client *nex.Client, callID uint32, message MessageInterface)
+	GetNumberOfMessagesHandler            func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient)
+	GetMessageHeadersHandler              func(err error, client *nex.Client, callID uint32, pid uint32, recipientType uint32, rangeOffset uint32, rangeSize uint32)
+	RetrieveAllMessagesWithinRangeHandler func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, resultRange *ResultRange)
+	RetrieveMessagesHandler               func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, messageIDs []uint32, leaveOnServer bool)
+	DeleteMessagesHandler                 func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, messageIDs []uint32)
+	DeleteAllMessagesHandler              func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient)
+	DeliverMessageMultiTargetHandler      func(err error, client *nex.Client, callID uint32, targets []*MessageRecipient, message MessageInterface)
+
+	// Mailbox, when set, answers every Messaging method for which no handler has been set
+	Mailbox Mailbox
+
+	// IsGatheringMember, when set, lets the members of a gathering read and deliver to its inbox with the default handlers.
+	// Gathering inboxes can't be used at all without it, and can never be deleted from by clients
+	IsGatheringMember func(pid uint32, gatheringID uint32) bool
+
+	// AccountStore, when set, supplies the sender name of messages delivered with the default handlers,
+	// and only lets messages be delivered to players who have an account.
+	// Without it messages are delivered without a sender name
+	AccountStore AccountStore
+}
+
+// MessageRecipient holds who a message is sent to, either a player or a gathering depending on RecipientType
+type MessageRecipient struct {
+	ID            uint32
+	RecipientType uint32
+}
+
+// Bytes encodes the MessageRecipient and returns a byte array
+func (messageRecipient *MessageRecipient) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt32LE(messageRecipient.ID)
+	stream.WriteUInt32LE(messageRecipient.RecipientType)
+
+	return stream.Bytes()
+}
+
+// MessageInterface is implemented by every message class which can be sent through the Messaging protocol
+type MessageInterface interface {
+	ClassName() string
+	Header() *UserMessage
+	Bytes(stream *StreamOut) []byte
+}
+
+// UserMessage holds the header shared by every message
+type UserMessage struct {
+	ID            uint32
+	ParentID      uint32
+	SenderPID     uint32
+	ReceptionTime *nex.DateTime
+	LifeTime      uint32
+	Flags         uint32
+	Subject       string
+	SenderName    string
+	Recipient     MessageRecipient
+}
+
+// ClassName returns the name of the message class
+func (userMessage *UserMessage) ClassName() string {
+	return "UserMessage"
+}
+
+// Header returns the UserMessage header of the message
+func (userMessage *UserMessage) Header() *UserMessage {
+	return userMessage
+}
+
+// Bytes encodes the UserMessage and returns a byte array
+func (userMessage *UserMessage) Bytes(stream *StreamOut) []byte {
+	var receptionTime uint64
+
+	if userMessage.ReceptionTime != nil {
+		receptionTime = userMessage.ReceptionTime.Value()
+	}
+
+	stream.WriteUInt32LE(userMessage.ID)
+	stream.WriteUInt32LE(userMessage.ParentID)
+	stream.WriteUInt32LE(userMessage.SenderPID)
+	stream.WriteUInt64LE(receptionTime)
+	stream.WriteUInt32LE(userMessage.LifeTime)
+	stream.WriteUInt32LE(userMessage.Flags)
+	stream.Write4ByteString(userMessage.Subject)
+	stream.Write4ByteString(userMessage.SenderName)
+	userMessage.Recipient.Bytes(stream)
+
+	return stream.Bytes()
+}
+
+// extractFromStream reads the UserMessage fields from a stream
+func (userMessage *UserMessage) extractFromStream(stream *StreamIn) error {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 28 {
+		return errors.New("[UserMessage::extractFromStream] Data size too small")
+	}
+
+	userMessage.ID = stream.ReadUInt32LE()
+	userMessage.ParentID = stream.ReadUInt32LE()
+	userMessage.SenderPID = stream.ReadUInt32LE()
+	userMessage.ReceptionTime = nex.NewDateTime(stream.ReadUInt64LE())
+	userMessage.LifeTime = stream.ReadUInt32LE()
+	userMessage.Flags = stream.ReadUInt32LE()
+
+	subject, err := stream.Read4ByteString()
+	if err != nil {
+		return err
+	}
+
+	senderName, err := stream.Read4ByteString()
+	if err != nil {
+		return err
+	}
+
+	recipient, err := stream.ReadMessageRecipient()
+	if err != nil {
+		return err
+	}
+
+	userMessage.Subject = subject
+	userMessage.SenderName = senderName
+	userMessage.Recipient = *recipient
+
+	return nil
+}
+
+// TextMessage is a UserMessage with a text body
+type TextMessage struct {
+	UserMessage
+	TextBody string
+}
+
+// ClassName returns the name of the message class
+func (textMessage *TextMessage) ClassName() string {
+	return "TextMessage"
+}
+
+// Bytes encodes the TextMessage and returns a byte array
+func (textMessage *TextMessage) Bytes(stream *StreamOut) []byte {
+	textMessage.UserMessage.Bytes(stream)
+	stream.Write4ByteString(textMessage.TextBody)
+
+	return stream.Bytes()
+}
+
+// BinaryMessage is a UserMessage with a binary body
+type BinaryMessage struct {
+	UserMessage
+	BinaryBody []byte
+}
+
+// ClassName returns the name of the message class
+func (binaryMessage *BinaryMessage) ClassName() string {
+	return "BinaryMessage"
+}
+
+// Bytes encodes the BinaryMessage and returns a byte array
+func (binaryMessage *BinaryMessage) Bytes(stream *StreamOut) []byte {
+	binaryMessage.UserMessage.Bytes(stream)
+	stream.WriteBuffer(binaryMessage.BinaryBody)
+
+	return stream.Bytes()
 }
 
 func (unknownProtocol *MessagingProtocol) Setup() {
@@ -26,8 +199,22 @@ func (unknownProtocol *MessagingProtocol) Setup() {
 
 		if MessagingProtocolID == request.ProtocolID() {
 			switch request.MethodID() {
+			case DeliverMessage:
+				go unknownProtocol.handleDeliverMessage(packet)
+			case GetNumberOfMessages:
+				go unknownProtocol.handleGetNumberOfMessages(packet)
 			case GetMessageHeaders:
 				go unknownProtocol.handleGetMessageHeaders(packet)
+			case RetrieveAllMessagesWithinRange:
+				go unknownProtocol.handleRetrieveAllMessagesWithinRange(packet)
+			case RetrieveMessages:
+				go unknownProtocol.handleRetrieveMessages(packet)
+			case DeleteMessages:
+				go unknownProtocol.handleDeleteMessages(packet)
+			case DeleteAllMessages:
+				go unknownProtocol.handleDeleteAllMessages(packet)
+			case DeliverMessageMultiTarget:
+				go unknownProtocol.handleDeliverMessageMultiTarget(packet)
 			default:
 				log.Printf("Unsupported Messaging method ID: %#v\n", request.MethodID())
 			}
@@ -35,12 +222,177 @@ func (unknownProtocol *MessagingProtocol) Setup() {
 	})
 }
 
+// DeliverMessage sets the DeliverMessage handler function
+func (messagingProtocol *MessagingProtocol) DeliverMessage(handler func(err error, client *nex.Client, callID uint32, message MessageInterface)) {
+	messagingProtocol.DeliverMessageHandler = handler
+}
+
+// GetNumberOfMessages sets the GetNumberOfMessages handler function
+func (messagingProtocol *MessagingProtocol) GetNumberOfMessages(handler func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient)) {
+	messagingProtocol.GetNumberOfMessagesHandler = handler
+}
+
 func (messagingProtocol *MessagingProtocol) GetMessageHeaders(handler func(err error, client *nex.Client, callID uint32, pid uint32, recipientType uint32, rangeOffset uint32, rangeSize uint32)) {
 	messagingProtocol.GetMessageHeadersHandler = handler
 }
 
+// RetrieveAllMessagesWithinRange sets the RetrieveAllMessagesWithinRange handler function
+func (messagingProtocol *MessagingProtocol) RetrieveAllMessagesWithinRange(handler func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, resultRange *ResultRange)) {
+	messagingProtocol.RetrieveAllMessagesWithinRangeHandler = handler
+}
+
+// RetrieveMessages sets the RetrieveMessages handler function
+func (messagingProtocol *MessagingProtocol) RetrieveMessages(handler func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, messageIDs []uint32, leaveOnServer bool)) {
+	messagingProtocol.RetrieveMessagesHandler = handler
+}
+
+// DeleteMessages sets the DeleteMessages handler function
+func (messagingProtocol *MessagingProtocol) DeleteMessages(handler func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, messageIDs []uint32)) {
+	messagingProtocol.DeleteMessagesHandler = handler
+}
+
+// DeleteAllMessages sets the DeleteAllMessages handler function
+func (messagingProtocol *MessagingProtocol) DeleteAllMessages(handler func(err error, client *nex.Client, callID uint32, recipient *MessageRecipient)) {
+	messagingProtocol.DeleteAllMessagesHandler = handler
+}
+
+// DeliverMessageMultiTarget sets the DeliverMessageMultiTarget handler function
+func (messagingProtocol *MessagingProtocol) DeliverMessageMultiTarget(handler func(err error, client *nex.Client, callID uint32, targets []*MessageRecipient, message MessageInterface)) {
+	messagingProtocol.DeliverMessageMultiTargetHandler = handler
+}
+
+// ReadMessage decodes the message held by a data holder
+func (messagingProtocol *MessagingProtocol) ReadMessage(dataHolder *DataHolder) (MessageInterface, error) {
+	stream := NewStreamIn(dataHolder.Data, messagingProtocol.server)
+
+	switch dataHolder.Name {
+	case "UserMessage":
+		userMessage := &UserMessage{}
+
+		if err := userMessage.extractFromStream(stream); err != nil {
+			return nil, err
+		}
+
+		return userMessage, nil
+	case "TextMessage":
+		textMessage := &TextMessage{}
+
+		if err := textMessage.UserMessage.extractFromStream(stream); err != nil {
+			return nil, err
+		}
+
+		textBody, err := stream.Read4ByteString()
+		if err != nil {
+			return nil, err
+		}
+
+		textMessage.TextBody = textBody
+
+		return textMessage, nil
+	case "BinaryMessage":
+		binaryMessage := &BinaryMessage{}
+
+		if err := binaryMessage.UserMessage.extractFromStream(stream); err != nil {
+			return nil, err
+		}
+
+		binaryBody, err := stream.ReadBuffer()
+		if err != nil {
+			return nil, err
+		}
+
+		binaryMessage.BinaryBody = binaryBody
+
+		return binaryMessage, nil
+	default:
+		return nil, errors.New("[MessagingProtocol::ReadMessage] Unsupported message class " + dataHolder.Name)
+	}
+}
+
+// MessageDataHolder wraps a message in a data holder, the counterpart of ReadMessage
+func (messagingProtocol *MessagingProtocol) MessageDataHolder(message MessageInterface) *DataHolder {
+	stream := NewStreamOut(messagingProtocol.server)
+
+	return &DataHolder{
+		Name: message.ClassName(),
+		Data: message.Bytes(stream),
+	}
+}
+
+func (messagingProtocol *MessagingProtocol) handleDeliverMessage(packet nex.PacketInterface) {
+	handler := messagingProtocol.DeliverMessageHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultDeliverMessage
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::DeliverMessage not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	dataHolder, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go handler(err, client, callID, nil)
+		return
+	}
+
+	message, err := messagingProtocol.ReadMessage(dataHolder)
+	if err != nil {
+		go handler(err, client, callID, nil)
+		return
+	}
+
+	go handler(nil, client, callID, message)
+}
+
+func (messagingProtocol *MessagingProtocol) handleGetNumberOfMessages(packet nex.PacketInterface) {
+	handler := messagingProtocol.GetNumberOfMessagesHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultGetNumberOfMessages
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::GetNumberOfMessages not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	recipient, err := parametersStream.ReadMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, nil)
+		return
+	}
+
+	go handler(nil, client, callID, recipient)
+}
+
 func (messagingProtocol *MessagingProtocol) handleGetMessageHeaders(packet nex.PacketInterface) {
-	if messagingProtocol.GetMessageHeadersHandler == nil {
+	handler := messagingProtocol.GetMessageHeadersHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultGetMessageHeaders
+	}
+
+	if handler == nil {
 		log.Println("[Warning] MessagingProtocol::GetMessageHeadersHandler not implemented")
 		go respondNotImplemented(packet, MessagingProtocolID)
 		return
@@ -54,12 +406,528 @@ func (messagingProtocol *MessagingProtocol) handleGetMessageHeaders(packet nex.P
 
 	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
 
-	pid := parametersStream.ReadUInt32LE()
-	recipientType := parametersStream.ReadUInt32LE() // 1 = PID,  2 = gathering ID
-	rangeOffset := parametersStream.ReadUInt32LE()
-	rangeSize := parametersStream.ReadUInt32LE()
+	recipient, err := parametersStream.ReadMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, 0, 0, 0, 0)
+		return
+	}
+
+	resultRange, err := parametersStream.ReadResultRange()
+	if err != nil {
+		go handler(err, client, callID, 0, 0, 0, 0)
+		return
+	}
+
+	go handler(nil, client, callID, recipient.ID, recipient.RecipientType, resultRange.Offset, resultRange.Size)
+}
+
+func (messagingProtocol *MessagingProtocol) handleRetrieveAllMessagesWithinRange(packet nex.PacketInterface) {
+	handler := messagingProtocol.RetrieveAllMessagesWithinRangeHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultRetrieveAllMessagesWithinRange
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::RetrieveAllMessagesWithinRange not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	recipient, err := parametersStream.ReadMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	resultRange, err := parametersStream.ReadResultRange()
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	go handler(nil, client, callID, recipient, resultRange)
+}
+
+func (messagingProtocol *MessagingProtocol) handleRetrieveMessages(packet nex.PacketInterface) {
+	handler := messagingProtocol.RetrieveMessagesHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultRetrieveMessages
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::RetrieveMessages not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	recipient, err := parametersStream.ReadMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, nil, nil, false)
+		return
+	}
+
+	messageIDs, err := parametersStream.ReadListUInt32LE()
+	if err != nil {
+		go handler(err, client, callID, nil, nil, false)
+		return
+	}
+
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 1 {
+		err := errors.New("[MessagingProtocol::RetrieveMessages] Data missing leave on server flag")
+		go handler(err, client, callID, nil, nil, false)
+		return
+	}
+
+	leaveOnServer := parametersStream.ReadBool()
+
+	go handler(nil, client, callID, recipient, messageIDs, leaveOnServer)
+}
+
+func (messagingProtocol *MessagingProtocol) handleDeleteMessages(packet nex.PacketInterface) {
+	handler := messagingProtocol.DeleteMessagesHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultDeleteMessages
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::DeleteMessages not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	recipient, err := parametersStream.ReadMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	messageIDs, err := parametersStream.ReadListUInt32LE()
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	go handler(nil, client, callID, recipient, messageIDs)
+}
+
+func (messagingProtocol *MessagingProtocol) handleDeleteAllMessages(packet nex.PacketInterface) {
+	handler := messagingProtocol.DeleteAllMessagesHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultDeleteAllMessages
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::DeleteAllMessages not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	recipient, err := parametersStream.ReadMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, nil)
+		return
+	}
+
+	go handler(nil, client, callID, recipient)
+}
+
+func (messagingProtocol *MessagingProtocol) handleDeliverMessageMultiTarget(packet nex.PacketInterface) {
+	handler := messagingProtocol.DeliverMessageMultiTargetHandler
+
+	if handler == nil && messagingProtocol.Mailbox != nil {
+		handler = messagingProtocol.defaultDeliverMessageMultiTarget
+	}
+
+	if handler == nil {
+		log.Println("[Warning] MessagingProtocol::DeliverMessageMultiTarget not implemented")
+		go respondNotImplemented(packet, MessagingProtocolID)
+		return
+	}
+
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	callID := request.CallID()
+	parameters := request.Parameters()
+
+	parametersStream := NewStreamIn(parameters, messagingProtocol.server)
+
+	targets, err := parametersStream.ReadListMessageRecipient()
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	dataHolder, err := parametersStream.ReadDataHolder()
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	message, err := messagingProtocol.ReadMessage(dataHolder)
+	if err != nil {
+		go handler(err, client, callID, nil, nil)
+		return
+	}
+
+	go handler(nil, client, callID, targets, message)
+}
+
+// RespondGetMessageHeaders sends the headers of messages as the response to GetMessageHeaders
+func (messagingProtocol *MessagingProtocol) RespondGetMessageHeaders(client *nex.Client, callID uint32, messages []MessageInterface) {
+	rmcResponseStream := NewStreamOut(messagingProtocol.server)
+
+	rmcResponseStream.WriteUInt32LE(uint32(len(messages)))
+	for _, message := range messages {
+		message.Header().Bytes(rmcResponseStream)
+	}
+
+	respondSuccess(client, MessagingProtocolID, callID, GetMessageHeaders, rmcResponseStream.Bytes())
+}
+
+func (messagingProtocol *MessagingProtocol) defaultDeliverMessage(err error, client *nex.Client, callID uint32, message MessageInterface) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	recipient := message.Header().Recipient
+
+	messagingProtocol.deliverMessage(client, callID, DeliverMessage, []*MessageRecipient{&recipient}, message)
+}
+
+func (messagingProtocol *MessagingProtocol) defaultGetNumberOfMessages(err error, client *nex.Client, callID uint32, recipient *MessageRecipient) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if !messagingProtocol.canReadInbox(client, recipient) {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	count, err := messagingProtocol.Mailbox.CountMessages(*recipient)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	rmcResponseStream := NewStreamOut(messagingProtocol.server)
+	rmcResponseStream.WriteUInt32LE(count)
+
+	respondSuccess(client, MessagingProtocolID, callID, GetNumberOfMessages, rmcResponseStream.Bytes())
+}
+
+func (messagingProtocol *MessagingProtocol) defaultGetMessageHeaders(err error, client *nex.Client, callID uint32, pid uint32, recipientType uint32, rangeOffset uint32, rangeSize uint32) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	recipient := &MessageRecipient{ID: pid, RecipientType: recipientType}
+
+	if !messagingProtocol.canReadInbox(client, recipient) {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	messages, err := messagingProtocol.Mailbox.GetMessages(*recipient, &ResultRange{Offset: rangeOffset, Size: rangeSize})
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	messagingProtocol.RespondGetMessageHeaders(client, callID, messages)
+}
+
+func (messagingProtocol *MessagingProtocol) defaultRetrieveAllMessagesWithinRange(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, resultRange *ResultRange) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if !messagingProtocol.canReadInbox(client, recipient) {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	messages, err := messagingProtocol.Mailbox.GetMessages(*recipient, resultRange)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	messagingProtocol.respondMessages(client, callID, RetrieveAllMessagesWithinRange, messages)
+}
+
+func (messagingProtocol *MessagingProtocol) defaultRetrieveMessages(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, messageIDs []uint32, leaveOnServer bool) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if !messagingProtocol.canReadInbox(client, recipient) {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	messages, err := messagingProtocol.Mailbox.GetMessagesByID(*recipient, messageIDs)
+
+	// messages of a gathering stay for its other members
+	if err == nil && !leaveOnServer && messagingProtocol.canDeleteFromInbox(client, recipient) {
+		_, err = messagingProtocol.Mailbox.DeleteMessages(*recipient, messageIDs)
+	}
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	messagingProtocol.respondMessages(client, callID, RetrieveMessages, messages)
+}
+
+func (messagingProtocol *MessagingProtocol) defaultDeleteMessages(err error, client *nex.Client, callID uint32, recipient *MessageRecipient, messageIDs []uint32) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if !messagingProtocol.canDeleteFromInbox(client, recipient) {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	if _, err := messagingProtocol.Mailbox.DeleteMessages(*recipient, messageIDs); err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	respondSuccess(client, MessagingProtocolID, callID, DeleteMessages, nil)
+}
+
+func (messagingProtocol *MessagingProtocol) defaultDeleteAllMessages(err error, client *nex.Client, callID uint32, recipient *MessageRecipient) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	if !messagingProtocol.canDeleteFromInbox(client, recipient) {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	removed, err := messagingProtocol.Mailbox.DeleteAllMessages(*recipient)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	rmcResponseStream := NewStreamOut(messagingProtocol.server)
+	rmcResponseStream.WriteUInt32LE(removed)
+
+	respondSuccess(client, MessagingProtocolID, callID, DeleteAllMessages, rmcResponseStream.Bytes())
+}
+
+func (messagingProtocol *MessagingProtocol) defaultDeliverMessageMultiTarget(err error, client *nex.Client, callID uint32, targets []*MessageRecipient, message MessageInterface) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	messagingProtocol.deliverMessage(client, callID, DeliverMessageMultiTarget, targets, message)
+}
+
+// deliverMessage stores message in the inbox of every target and responds with the delivered message
+// followed by the IDs of the targets it was and wasn't delivered to
+func (messagingProtocol *MessagingProtocol) deliverMessage(client *nex.Client, callID uint32, methodID uint32, targets []*MessageRecipient, message MessageInterface) {
+	pid := client.PID()
+
+	if pid == 0 {
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreAccessDenied)
+		return
+	}
+
+	senderName, err := messagingProtocol.senderName(pid)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, MessagingProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	// don't trust the client about who sent the message
+	message.Header().SenderPID = pid
+	message.Header().SenderName = senderName
+
+	delivered := message
+	transmitSuccess := make([]uint32, 0, len(targets))
+	transmitFailed := make([]uint32, 0)
+
+	for _, target := range targets {
+		if !messagingProtocol.canDeliverToInbox(pid, target) {
+			transmitFailed = append(transmitFailed, target.ID)
+			continue
+		}
+
+		deliveredMessage, err := messagingProtocol.Mailbox.DeliverMessage(*target, message)
+
+		if err != nil {
+			log.Println(err)
+			transmitFailed = append(transmitFailed, target.ID)
+			continue
+		}
+
+		delivered = deliveredMessage
+		transmitSuccess = append(transmitSuccess, target.ID)
+	}
+
+	rmcResponseStream := NewStreamOut(messagingProtocol.server)
+
+	rmcResponseStream.WriteDataHolder(messagingProtocol.MessageDataHolder(delivered))
+
+	rmcResponseStream.WriteUInt32LE(uint32(len(transmitSuccess)))
+	for _, id := range transmitSuccess {
+		rmcResponseStream.WriteUInt32LE(id)
+	}
+
+	rmcResponseStream.WriteUInt32LE(uint32(len(transmitFailed)))
+	for _, id := range transmitFailed {
+		rmcResponseStream.WriteUInt32LE(id)
+	}
+
+	respondSuccess(client, MessagingProtocolID, callID, methodID, rmcResponseStream.Bytes())
+}
+
+// respondMessages responds with a list of messages, each wrapped in a data holder
+func (messagingProtocol *MessagingProtocol) respondMessages(client *nex.Client, callID uint32, methodID uint32, messages []MessageInterface) {
+	rmcResponseStream := NewStreamOut(messagingProtocol.server)
+
+	rmcResponseStream.WriteUInt32LE(uint32(len(messages)))
+	for _, message := range messages {
+		rmcResponseStream.WriteDataHolder(messagingProtocol.MessageDataHolder(message))
+	}
+
+	respondSuccess(client, MessagingProtocolID, callID, methodID, rmcResponseStream.Bytes())
+}
+
+// canReadInbox checks that a player inbox belongs to the client, or that the client is a member of a gathering
+func (messagingProtocol *MessagingProtocol) canReadInbox(client *nex.Client, recipient *MessageRecipient) bool {
+	pid := client.PID()
+
+	if pid == 0 {
+		return false
+	}
+
+	switch recipient.RecipientType {
+	case MessageRecipientTypePID:
+		return recipient.ID == pid
+	case MessageRecipientTypeGathering:
+		return messagingProtocol.isGatheringMember(pid, recipient.ID)
+	}
+
+	return false
+}
+
+// canDeliverToInbox checks that a player may send to an inbox. Player inboxes may be sent to by anyone, gathering inboxes only by their members
+func (messagingProtocol *MessagingProtocol) canDeliverToInbox(pid uint32, recipient *MessageRecipient) bool {
+	switch recipient.RecipientType {
+	case MessageRecipientTypePID:
+		return recipient.ID != 0 && messagingProtocol.hasAccount(recipient.ID)
+	case MessageRecipientTypeGathering:
+		return messagingProtocol.isGatheringMember(pid, recipient.ID)
+	}
+
+	return false
+}
+
+func (messagingProtocol *MessagingProtocol) isGatheringMember(pid uint32, gatheringID uint32) bool {
+	return messagingProtocol.IsGatheringMember != nil && messagingProtocol.IsGatheringMember(pid, gatheringID)
+}
+
+// hasAccount checks that a player exists, which can only be known with an AccountStore
+func (messagingProtocol *MessagingProtocol) hasAccount(pid uint32) bool {
+	if messagingProtocol.AccountStore == nil {
+		return true
+	}
+
+	_, err := messagingProtocol.AccountStore.LookupAccountByPID(pid)
+
+	return err == nil
+}
+
+// senderName returns the account name of the sender of a message, or an empty name without an AccountStore
+func (messagingProtocol *MessagingProtocol) senderName(pid uint32) (string, error) {
+	if messagingProtocol.AccountStore == nil {
+		return "", nil
+	}
+
+	account, err := messagingProtocol.AccountStore.LookupAccountByPID(pid)
+
+	if err != nil {
+		return "", err
+	}
+
+	return account.Name, nil
+}
 
-	go messagingProtocol.GetMessageHeadersHandler(nil, client, callID, pid, recipientType, rangeOffset, rangeSize)
+// canDeleteFromInbox checks that an inbox belongs to the client. Gathering inboxes are shared, so nobody may delete from them
+func (messagingProtocol *MessagingProtocol) canDeleteFromInbox(client *nex.Client, recipient *MessageRecipient) bool {
+	return recipient.RecipientType == MessageRecipientTypePID && messagingProtocol.canReadInbox(client, recipient)
 }
 
 // NewMessagingProtocol returns a new MessagingProtocol
@@ -0,0 +1,85 @@
+package nexproto
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMessagingCanDeliverToInbox(t *testing.T) {
+	messagingProtocol := &MessagingProtocol{
+		IsGatheringMember: func(pid uint32, gatheringID uint32) bool {
+			return pid == 1000 && gatheringID == 50
+		},
+	}
+
+	tests := []struct {
+		name      string
+		pid       uint32
+		recipient MessageRecipient
+		allowed   bool
+	}{
+		{"other player", 1000, MessageRecipient{1001, MessageRecipientTypePID}, true},
+		{"own inbox", 1000, MessageRecipient{1000, MessageRecipientTypePID}, true},
+		{"PID 0", 1000, MessageRecipient{0, MessageRecipientTypePID}, false},
+		{"member of gathering", 1000, MessageRecipient{50, MessageRecipientTypeGathering}, true},
+		{"not a member of gathering", 1001, MessageRecipient{50, MessageRecipientTypeGathering}, false},
+		{"other gathering", 1000, MessageRecipient{51, MessageRecipientTypeGathering}, false},
+		{"unknown recipient type", 1000, MessageRecipient{1001, 3}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed := messagingProtocol.canDeliverToInbox(test.pid, &test.recipient); allowed != test.allowed {
+				t.Fatalf("got %v, want %v", allowed, test.allowed)
+			}
+		})
+	}
+
+	// without IsGatheringMember nobody is a member of any gathering
+	if (&MessagingProtocol{}).canDeliverToInbox(1000, &MessageRecipient{50, MessageRecipientTypeGathering}) {
+		t.Fatal("delivered to a gathering without IsGatheringMember")
+	}
+}
+
+func TestMessagingCanDeliverToInboxWithAccountStore(t *testing.T) {
+	accountStore := NewMemoryAccountStore(1000)
+	account, err := accountStore.CreateAccount(&Account{Name: "alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messagingProtocol := &MessagingProtocol{AccountStore: accountStore}
+
+	if !messagingProtocol.canDeliverToInbox(account.PID+1, &MessageRecipient{account.PID, MessageRecipientTypePID}) {
+		t.Fatal("could not deliver to an existing account")
+	}
+
+	// arbitrary recipient IDs would each open a new inbox
+	if messagingProtocol.canDeliverToInbox(account.PID, &MessageRecipient{account.PID + 1, MessageRecipientTypePID}) {
+		t.Fatal("delivered to a PID without an account")
+	}
+}
+
+func TestMessagingSenderName(t *testing.T) {
+	accountStore := NewMemoryAccountStore(1000)
+	account, err := accountStore.CreateAccount(&Account{Name: "alice"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messagingProtocol := &MessagingProtocol{AccountStore: accountStore}
+
+	if senderName, err := messagingProtocol.senderName(account.PID); err != nil || senderName != "alice" {
+		t.Fatalf("got %q, %v, want alice", senderName, err)
+	}
+
+	if _, err := messagingProtocol.senderName(account.PID + 1); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("got %v, want ErrAccountNotFound", err)
+	}
+
+	if senderName, err := (&MessagingProtocol{}).senderName(account.PID); err != nil || senderName != "" {
+		t.Fatalf("got %q, %v without an AccountStore, want an empty name", senderName, err)
+	}
+}
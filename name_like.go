@@ -0,0 +1,165 @@
+package nexproto
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MaxNameLikePatternLength is the longest FindByNameLike pattern that will be parsed
+const MaxNameLikePatternLength = 256
+
+// NameLikeEscapeCharacter escapes the character after it in FindByNameLike patterns sent by clients
+const NameLikeEscapeCharacter = '\\'
+
+// nameLikeSQLEscapeCharacter escapes the character after it in the SQL built from patterns.
+// It is not a backslash because MySQL treats backslashes inside string literals as escapes
+const nameLikeSQLEscapeCharacter = '!'
+
+var sqlColumnRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+type nameLikeTokenType int
+
+const (
+	nameLikeLiteral nameLikeTokenType = iota
+	nameLikeAnyRun
+	nameLikeAnyCharacter
+)
+
+type nameLikeToken struct {
+	tokenType nameLikeTokenType
+	character rune
+}
+
+// NameLikePattern is a parsed FindByNameLike pattern.
+// % matches any run of characters, _ matches any single character and \\ escapes the character after it.
+// Names are matched without regard to the case of ASCII letters only, the same as LOWER in SQLite
+// so memory and SQL stores find the same names
+type NameLikePattern struct {
+	pattern string
+	tokens  []nameLikeToken
+}
+
+// String returns the pattern as sent by the client
+func (nameLikePattern *NameLikePattern) String() string {
+	return nameLikePattern.pattern
+}
+
+// Match checks if a name matches the pattern
+func (nameLikePattern *NameLikePattern) Match(name string) bool {
+	tokens := nameLikePattern.tokens
+	nameRunes := []rune(name)
+
+	for i, nameRune := range nameRunes {
+		nameRunes[i] = asciiToLower(nameRune)
+	}
+
+	tokenIndex, nameIndex := 0, 0
+	anyRunIndex, anyRunNameIndex := -1, 0
+
+	for nameIndex < len(nameRunes) {
+		if tokenIndex < len(tokens) && tokens[tokenIndex].tokenType == nameLikeAnyRun {
+			anyRunIndex = tokenIndex
+			anyRunNameIndex = nameIndex
+			tokenIndex++
+		} else if tokenIndex < len(tokens) && (tokens[tokenIndex].tokenType == nameLikeAnyCharacter || tokens[tokenIndex].character == nameRunes[nameIndex]) {
+			tokenIndex++
+			nameIndex++
+		} else if anyRunIndex != -1 {
+			// let the last % swallow one more character
+			tokenIndex = anyRunIndex + 1
+			anyRunNameIndex++
+			nameIndex = anyRunNameIndex
+		} else {
+			return false
+		}
+	}
+
+	for tokenIndex < len(tokens) && tokens[tokenIndex].tokenType == nameLikeAnyRun {
+		tokenIndex++
+	}
+
+	return tokenIndex == len(tokens)
+}
+
+// SQL returns a parameterized condition matching column against the pattern, along with its arguments.
+// The condition uses LOWER, LIKE and ESCAPE, which SQLite, MySQL and PostgreSQL all support.
+// column must be a plain (optionally table qualified) column name
+func (nameLikePattern *NameLikePattern) SQL(column string) (string, []interface{}, error) {
+	if !sqlColumnRegex.MatchString(column) {
+		return "", nil, errors.New("[NameLikePattern::SQL] Invalid column name")
+	}
+
+	var likePattern strings.Builder
+
+	for _, token := range nameLikePattern.tokens {
+		switch token.tokenType {
+		case nameLikeAnyRun:
+			likePattern.WriteRune('%')
+		case nameLikeAnyCharacter:
+			likePattern.WriteRune('_')
+		default:
+			if token.character == '%' || token.character == '_' || token.character == nameLikeSQLEscapeCharacter {
+				likePattern.WriteRune(nameLikeSQLEscapeCharacter)
+			}
+
+			likePattern.WriteRune(token.character)
+		}
+	}
+
+	return "LOWER(" + column + ") LIKE ? ESCAPE '" + string(nameLikeSQLEscapeCharacter) + "'", []interface{}{likePattern.String()}, nil
+}
+
+// ParseNameLikePattern parses a FindByNameLike pattern
+func ParseNameLikePattern(pattern string) (*NameLikePattern, error) {
+	if len(pattern) > MaxNameLikePatternLength {
+		return nil, errors.New("[ParseNameLikePattern] Pattern too long")
+	}
+
+	tokens := make([]nameLikeToken, 0, len(pattern))
+	escaped := false
+
+	for _, character := range pattern {
+		if unicode.IsControl(character) {
+			return nil, errors.New("[ParseNameLikePattern] Pattern contains a control character")
+		}
+
+		switch {
+		case escaped:
+			tokens = append(tokens, nameLikeToken{tokenType: nameLikeLiteral, character: asciiToLower(character)})
+			escaped = false
+		case character == NameLikeEscapeCharacter:
+			escaped = true
+		case character == '%':
+			// consecutive wildcards match the same names as one
+			if len(tokens) == 0 || tokens[len(tokens)-1].tokenType != nameLikeAnyRun {
+				tokens = append(tokens, nameLikeToken{tokenType: nameLikeAnyRun})
+			}
+		case character == '_':
+			tokens = append(tokens, nameLikeToken{tokenType: nameLikeAnyCharacter})
+		default:
+			tokens = append(tokens, nameLikeToken{tokenType: nameLikeLiteral, character: asciiToLower(character)})
+		}
+	}
+
+	if escaped {
+		return nil, errors.New("[ParseNameLikePattern] Pattern ends with an escape character")
+	}
+
+	nameLikePattern := &NameLikePattern{
+		pattern: pattern,
+		tokens:  tokens,
+	}
+
+	return nameLikePattern, nil
+}
+
+// asciiToLower lowers ASCII letters and leaves every other character alone
+func asciiToLower(character rune) rune {
+	if character >= 'A' && character <= 'Z' {
+		return character + ('a' - 'A')
+	}
+
+	return character
+}
@@ -0,0 +1,149 @@
+package nexproto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNameLikePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		wantErr bool
+	}{
+		{"plain", "alice", false},
+		{"wildcards", "a%c_", false},
+		{"escaped wildcards", `100\%\_`, false},
+		{"escaped escape", `back\\slash`, false},
+		{"exclamation mark is literal", "hi!", false},
+		{"empty", "", false},
+		{"trailing escape", `alice\`, true},
+		{"control character", "ali\x00ce", true},
+		{"too long", strings.Repeat("a", MaxNameLikePatternLength+1), true},
+		{"max length", strings.Repeat("a", MaxNameLikePatternLength), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nameLikePattern, err := ParseNameLikePattern(test.pattern)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if nameLikePattern.String() != test.pattern {
+				t.Fatalf("got %q, want %q", nameLikePattern.String(), test.pattern)
+			}
+		})
+	}
+}
+
+func TestNameLikePatternMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"alice", "alice", true},
+		{"alice", "ALICE", true},
+		{"ALICE", "alice", true},
+		{"alice", "alicia", false},
+		{"al%", "alice", true},
+		{"al%", "al", true},
+		{"%ice", "alice", true},
+		{"%l%c%", "alice", true},
+		{"%%", "", true},
+		{"", "", true},
+		{"", "a", false},
+		{"a_ice", "alice", true},
+		{"a_ice", "aice", false},
+		{"a%e", "abcde", true},
+		{"a%e", "abcdef", false},
+		{`100\%`, "100%", true},
+		{`100\%`, "1000", false},
+		{`a\_b`, "a_b", true},
+		{`a\_b`, "axb", false},
+		{`back\\slash`, `back\slash`, true},
+		{"hi!", "hi!", true},
+		{"hi!", "hix", false},
+		{"_", "é", true},
+		// only ASCII letters are folded, the same as LOWER in SQLite
+		{"émile", "émile", true},
+		{"émile", "Émile", false},
+		{"ÉMILE", "Émile", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.name, func(t *testing.T) {
+			nameLikePattern, err := ParseNameLikePattern(test.pattern)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if nameLikePattern.Match(test.name) != test.match {
+				t.Fatalf("got match %v, want %v", !test.match, test.match)
+			}
+		})
+	}
+}
+
+func TestNameLikePatternSQL(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		column      string
+		condition   string
+		likePattern string
+		wantErr     bool
+	}{
+		{"Alice", "name", "LOWER(name) LIKE ? ESCAPE '!'", "alice", false},
+		{"a%c_", "accounts.name", "LOWER(accounts.name) LIKE ? ESCAPE '!'", "a%c_", false},
+		{`100\%\_`, "name", "LOWER(name) LIKE ? ESCAPE '!'", "100!%!_", false},
+		{"hi!", "name", "LOWER(name) LIKE ? ESCAPE '!'", "hi!!", false},
+		{`back\\slash`, "name", "LOWER(name) LIKE ? ESCAPE '!'", `back\slash`, false},
+		{"ÉMILE", "name", "LOWER(name) LIKE ? ESCAPE '!'", "Émile", false},
+		{"alice", "name; DROP TABLE accounts", "", "", true},
+		{"alice", "LOWER(name)", "", "", true},
+		{"alice", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.pattern+" "+test.column, func(t *testing.T) {
+			nameLikePattern, err := ParseNameLikePattern(test.pattern)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			condition, arguments, err := nameLikePattern.SQL(test.column)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if condition != test.condition {
+				t.Fatalf("got condition %q, want %q", condition, test.condition)
+			}
+
+			if len(arguments) != 1 || arguments[0] != test.likePattern {
+				t.Fatalf("got arguments %q, want [%q]", arguments, test.likePattern)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package nexproto
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
@@ -37,6 +38,26 @@ func bytesToUint64(input []byte) uint64 {
 	return result
 }
 
+// maxFriendCode is the largest friend code with 16 decimal digits
+const maxFriendCode = 9999999999999999
+
+// readFriendCode reads a 7 byte Wii console friend code and returns its value
+func readFriendCode(stream *nex.StreamIn) uint64 {
+	friendCode := make([]byte, 7)
+
+	for i := 0; i < 7; i++ {
+		friendCode[i] = stream.ReadUInt8()
+	}
+
+	return bytesToUint64(reverseBytes(friendCode))
+}
+
+// isValidFriendCode checks that a friend code is non-zero and fits in the 16 digits of a Wii number.
+// 7 bytes can hold values up to 17 digits, so larger values can't be real friend codes
+func isValidFriendCode(friendCode uint64) bool {
+	return friendCode != 0 && friendCode <= maxFriendCode
+}
+
 // Setup initializes the protocol
 func (nintendoManagementProtocol *NintendoManagementProtocol) Setup() {
 	nexServer := nintendoManagementProtocol.server
@@ -75,13 +96,13 @@ func (nintendoManagementProtocol *NintendoManagementProtocol) handleGetConsoleUs
 
 	parametersStream := NewStreamIn(parameters, nintendoManagementProtocol.server)
 
-	friendCode := make([]byte, 7)
-
-	for i := 0; i < 7; i++ {
-		friendCode[i] = parametersStream.ReadUInt8()
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 7 {
+		err := errors.New("[NintendoManagementProtocol::GetConsoleUsernames] Data missing friend code")
+		go nintendoManagementProtocol.GetConsoleUsernamesHandler(err, client, callID, "")
+		return
 	}
 
-	finalFriendCode := fmt.Sprintf("%d", bytesToUint64(reverseBytes(friendCode)))
+	finalFriendCode := fmt.Sprintf("%d", readFriendCode(parametersStream.StreamIn))
 
 	go nintendoManagementProtocol.GetConsoleUsernamesHandler(nil, client, callID, finalFriendCode)
 }
@@ -0,0 +1,167 @@
+package nexproto
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Known Rock Band 3 presence fields
+const (
+	PresenceFieldSong       = "song"
+	PresenceFieldBand       = "band"
+	PresenceFieldState      = "state"
+	PresenceFieldInstrument = "instrument"
+)
+
+// ErrPresenceNotFound is returned by a PresenceStore when a player never set a status
+var ErrPresenceNotFound = errors.New("[PresenceStore] Presence not found")
+
+// DefaultPresenceOnlineTimeout is how long a player counts as online after their last status update
+const DefaultPresenceOnlineTimeout = 5 * time.Minute
+
+// Presence holds a decoded SetStatus status string.
+// Statuses made of key=value pairs separated by semicolons, e.g. "state=playing;song=Foreplay;band=The Band", are decoded.
+// Statuses in any other format are kept in Raw with Decoded set to false
+type Presence struct {
+	PID        uint32
+	Raw        string
+	Decoded    bool
+	Song       string
+	Band       string
+	State      string
+	Instrument string
+	Fields     map[string]string
+	UpdatedAt  time.Time
+}
+
+// ParsePresence decodes a SetStatus status string, keeping only Raw when it isn't made of key=value pairs
+func ParsePresence(status string) *Presence {
+	presence := &Presence{
+		Raw:    status,
+		Fields: make(map[string]string),
+	}
+
+	if !strings.Contains(status, "=") {
+		return presence
+	}
+
+	for _, pair := range strings.Split(status, ";") {
+		if pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if !ok || key == "" {
+			// not a status we know how to read, keep only the raw string
+			return &Presence{
+				Raw:    status,
+				Fields: make(map[string]string),
+			}
+		}
+
+		presence.Fields[key] = strings.TrimSpace(value)
+	}
+
+	presence.Decoded = true
+	presence.Song = presence.Fields[PresenceFieldSong]
+	presence.Band = presence.Fields[PresenceFieldBand]
+	presence.State = presence.Fields[PresenceFieldState]
+	presence.Instrument = presence.Fields[PresenceFieldInstrument]
+
+	return presence
+}
+
+// PresenceStore keeps the latest presence of every player who set a status
+type PresenceStore interface {
+	SetPresence(presence *Presence) error
+	LookupPresence(pid uint32) (*Presence, error)
+	OnlinePresences(now time.Time) ([]*Presence, error)
+	RemovePresence(pid uint32) error
+}
+
+// MemoryPresenceStore is a PresenceStore which keeps presences in memory.
+// A player counts as online for OnlineTimeout after their last status update
+type MemoryPresenceStore struct {
+	OnlineTimeout time.Duration
+
+	mutex     sync.RWMutex
+	presences map[uint32]*Presence
+}
+
+// SetPresence replaces the presence of presence.PID
+func (memoryPresenceStore *MemoryPresenceStore) SetPresence(presence *Presence) error {
+	memoryPresenceStore.mutex.Lock()
+	defer memoryPresenceStore.mutex.Unlock()
+
+	memoryPresenceStore.presences[presence.PID] = copyPresence(presence)
+
+	return nil
+}
+
+// LookupPresence returns the latest presence of a player, online or not
+func (memoryPresenceStore *MemoryPresenceStore) LookupPresence(pid uint32) (*Presence, error) {
+	memoryPresenceStore.mutex.RLock()
+	defer memoryPresenceStore.mutex.RUnlock()
+
+	presence, ok := memoryPresenceStore.presences[pid]
+
+	if !ok {
+		return nil, ErrPresenceNotFound
+	}
+
+	return copyPresence(presence), nil
+}
+
+// OnlinePresences returns the presence of every player who updated their status within OnlineTimeout of now, ordered by PID
+func (memoryPresenceStore *MemoryPresenceStore) OnlinePresences(now time.Time) ([]*Presence, error) {
+	memoryPresenceStore.mutex.RLock()
+	defer memoryPresenceStore.mutex.RUnlock()
+
+	presences := make([]*Presence, 0)
+
+	for _, presence := range memoryPresenceStore.presences {
+		if now.Sub(presence.UpdatedAt) < memoryPresenceStore.OnlineTimeout {
+			presences = append(presences, copyPresence(presence))
+		}
+	}
+
+	sort.Slice(presences, func(i, j int) bool {
+		return presences[i].PID < presences[j].PID
+	})
+
+	return presences, nil
+}
+
+// RemovePresence forgets the presence of a player when they disconnect
+func (memoryPresenceStore *MemoryPresenceStore) RemovePresence(pid uint32) error {
+	memoryPresenceStore.mutex.Lock()
+	defer memoryPresenceStore.mutex.Unlock()
+
+	delete(memoryPresenceStore.presences, pid)
+
+	return nil
+}
+
+// NewMemoryPresenceStore returns a new MemoryPresenceStore
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{
+		OnlineTimeout: DefaultPresenceOnlineTimeout,
+		presences:     make(map[uint32]*Presence),
+	}
+}
+
+func copyPresence(presence *Presence) *Presence {
+	presenceCopy := *presence
+	presenceCopy.Fields = make(map[string]string, len(presence.Fields))
+
+	for key, value := range presence.Fields {
+		presenceCopy.Fields[key] = value
+	}
+
+	return &presenceCopy
+}
@@ -0,0 +1,141 @@
+package nexproto
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePresence(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		decoded  bool
+		song     string
+		band     string
+		state    string
+		fieldLen int
+	}{
+		{"full status", "state=playing;song=Foreplay;band=The Band;instrument=drums", true, "Foreplay", "The Band", "playing", 4},
+		{"keys are folded and trimmed", " State = menu ; SONG=Roam", true, "Roam", "", "menu", 2},
+		{"empty pairs are skipped", "state=online;;", true, "", "", "online", 1},
+		{"unknown fields are kept", "state=online;venue=club", true, "", "", "online", 2},
+		{"opaque status", "In the music store", false, "", "", "", 0},
+		{"pair without equals", "state=online;oops", false, "", "", "", 0},
+		{"empty key", "=value", false, "", "", "", 0},
+		{"empty status", "", false, "", "", "", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			presence := ParsePresence(test.status)
+
+			if presence.Raw != test.status {
+				t.Fatalf("got raw %q, want %q", presence.Raw, test.status)
+			}
+
+			if presence.Decoded != test.decoded {
+				t.Fatalf("got decoded %v, want %v", presence.Decoded, test.decoded)
+			}
+
+			if presence.Song != test.song || presence.Band != test.band || presence.State != test.state {
+				t.Fatalf("got song %q, band %q, state %q", presence.Song, presence.Band, presence.State)
+			}
+
+			if len(presence.Fields) != test.fieldLen {
+				t.Fatalf("got %d fields, want %d", len(presence.Fields), test.fieldLen)
+			}
+		})
+	}
+
+	if instrument := ParsePresence("instrument=bass").Instrument; instrument != "bass" {
+		t.Fatalf("got instrument %q, want bass", instrument)
+	}
+}
+
+func TestMemoryPresenceStore(t *testing.T) {
+	memoryPresenceStore := NewMemoryPresenceStore()
+	memoryPresenceStore.OnlineTimeout = time.Minute
+	now := time.Now()
+
+	for _, presence := range []*Presence{
+		{PID: 1002, Raw: "state=menu", UpdatedAt: now},
+		{PID: 1000, Raw: "state=playing", UpdatedAt: now.Add(-30 * time.Second)},
+		{PID: 1001, Raw: "state=idle", UpdatedAt: now.Add(-2 * time.Minute)},
+	} {
+		if err := memoryPresenceStore.SetPresence(presence); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	presences, err := memoryPresenceStore.OnlinePresences(now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(presences) != 2 || presences[0].PID != 1000 || presences[1].PID != 1002 {
+		t.Fatalf("got online presences %+v, want 1000 and 1002", presences)
+	}
+
+	// players who timed out can still be looked up
+	if presence, err := memoryPresenceStore.LookupPresence(1001); err != nil || presence.Raw != "state=idle" {
+		t.Fatalf("got %+v, %v", presence, err)
+	}
+
+	if err := memoryPresenceStore.RemovePresence(1000); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := memoryPresenceStore.LookupPresence(1000); !errors.Is(err, ErrPresenceNotFound) {
+		t.Fatalf("got %v, want ErrPresenceNotFound", err)
+	}
+}
+
+func TestMemoryPresenceStoreCopiesPresence(t *testing.T) {
+	memoryPresenceStore := NewMemoryPresenceStore()
+	presence := ParsePresence("state=playing")
+	presence.PID = 1000
+
+	if err := memoryPresenceStore.SetPresence(presence); err != nil {
+		t.Fatal(err)
+	}
+
+	presence.Fields[PresenceFieldState] = "changed"
+
+	stored, err := memoryPresenceStore.LookupPresence(1000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Fields[PresenceFieldState] != "playing" {
+		t.Fatalf("stored presence changed through the caller's copy: %+v", stored.Fields)
+	}
+}
+
+func TestAccountManagementRemovePresence(t *testing.T) {
+	memoryPresenceStore := NewMemoryPresenceStore()
+	accountManagementProtocol := &AccountManagementProtocol{PresenceStore: memoryPresenceStore}
+
+	for _, pid := range []uint32{0, 1000} {
+		if err := memoryPresenceStore.SetPresence(&Presence{PID: pid, UpdatedAt: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accountManagementProtocol.removePresence(1000)
+	accountManagementProtocol.removePresence(0)
+
+	if _, err := memoryPresenceStore.LookupPresence(1000); !errors.Is(err, ErrPresenceNotFound) {
+		t.Fatalf("got %v, want the presence to be removed", err)
+	}
+
+	// PID 0 is shared by every client which hasn't logged in, one of them leaving says nothing about the others
+	if _, err := memoryPresenceStore.LookupPresence(0); err != nil {
+		t.Fatalf("got %v, want the PID 0 presence to be kept", err)
+	}
+
+	// without a store there is nothing to remove
+	(&AccountManagementProtocol{}).removePresence(1000)
+}
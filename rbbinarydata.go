@@ -1,7 +1,11 @@
 package nexproto
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	nex "github.com/ihatecompvir/nex-go"
 )
@@ -16,10 +20,47 @@ const (
 	GetBinaryData = 2
 )
 
+// DefaultMaxBlobSize is the default largest blob accepted by SaveBinaryData
+const DefaultMaxBlobSize = 1024 * 1024
+
+// DefaultQuarantineInterval is the default shortest time between two blobs quarantined for the same player
+const DefaultQuarantineInterval = time.Minute
+
+// QuarantineKey is the key refused blobs are saved under in the Quarantine
+const QuarantineKey = "refused"
+
 type RBBinaryDataProtocol struct {
 	server                *nex.Server
-	SaveBinaryDataHandler func(err error, client *nex.Client, callID uint32, metadata string, blob []byte)
+	SaveBinaryDataHandler func(err error, client *nex.Client, callID uint32, metadata string, blob []byte, reservation *BinaryDataReservation)
 	GetBinaryDataHandler  func(err error, client *nex.Client, callID uint32, metadata string)
+
+	// BlobStore, when set, answers SaveBinaryData and GetBinaryData for which no handler has been set.
+	// The default handlers expect the metadata to be a BinaryDataDescriptor and only let players write their own blobs
+	BlobStore BlobStore
+
+	// MaxBlobSize is the largest blob accepted by SaveBinaryData
+	MaxBlobSize uint32
+
+	// PublicBinaryDataTypes holds the descriptor types every player may read, e.g. band logos shown to bandmates.
+	// Blobs of any other type can only be read by their owner
+	PublicBinaryDataTypes map[string]bool
+
+	// Validators check every blob before the default SaveBinaryData handler saves it
+	Validators []BinaryDataValidator
+
+	// Quarantine, when set, keeps a copy of the last blob refused by Validators for each player under QuarantineKey, for later inspection.
+	// At most one blob per player is quarantined every QuarantineInterval
+	Quarantine         BlobStore
+	QuarantineInterval time.Duration
+
+	// Quota, when set, limits how much players may store. The default SaveBinaryData handler accounts for blobs
+	// under their descriptor, a custom handler is only called once the blob is accounted for under the client PID
+	// and the raw metadata, and gets the reservation. Custom handlers which fail to save the blob should cancel it
+	Quota *BinaryDataQuota
+
+	quarantineMutex     sync.Mutex
+	lastQuarantined     map[uint32]time.Time
+	lastQuarantinePrune time.Time
 }
 
 // Setup initializes the protocol
@@ -43,7 +84,7 @@ func (rbBinaryDataProtocol *RBBinaryDataProtocol) Setup() {
 }
 
 // SaveBinaryData sets the SaveBinaryData handler function
-func (rbBinaryDataProtocol *RBBinaryDataProtocol) SaveBinaryData(handler func(err error, client *nex.Client, callID uint32, metadata string, blob []byte)) {
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) SaveBinaryData(handler func(err error, client *nex.Client, callID uint32, metadata string, blob []byte, reservation *BinaryDataReservation)) {
 	rbBinaryDataProtocol.SaveBinaryDataHandler = handler
 }
 
@@ -53,7 +94,13 @@ func (rbBinaryDataProtocol *RBBinaryDataProtocol) GetBinaryData(handler func(err
 }
 
 func (rbBinaryDataProtocol *RBBinaryDataProtocol) handleSaveBinaryData(packet nex.PacketInterface) {
-	if rbBinaryDataProtocol.SaveBinaryDataHandler == nil {
+	handler := rbBinaryDataProtocol.SaveBinaryDataHandler
+
+	if handler == nil && rbBinaryDataProtocol.BlobStore != nil {
+		handler = rbBinaryDataProtocol.defaultSaveBinaryData
+	}
+
+	if handler == nil {
 		log.Println("[Warning] RBBinaryDataProtocol::SaveBinaryData not implemented")
 		go respondNotImplemented(packet, RBBinaryDataProtocolID)
 		return
@@ -69,21 +116,56 @@ func (rbBinaryDataProtocol *RBBinaryDataProtocol) handleSaveBinaryData(packet ne
 
 	metadata, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go rbBinaryDataProtocol.SaveBinaryDataHandler(err, client, callID, "", nil)
+		go handler(err, client, callID, "", nil, nil)
 		return
 	}
 
-	blob, err := parametersStream.ReadBuffer()
-	if err != nil {
-		go rbBinaryDataProtocol.SaveBinaryDataHandler(err, client, callID, "", nil)
+	if len(parametersStream.Bytes()[parametersStream.ByteOffset():]) < 4 {
+		err := errors.New("[RBBinaryDataProtocol::SaveBinaryData] Data missing blob length")
+		go handler(err, client, callID, "", nil, nil)
 		return
 	}
 
-	go rbBinaryDataProtocol.SaveBinaryDataHandler(nil, client, callID, metadata, blob)
+	// check the length before reading so oversized blobs are never copied
+	blobLength := parametersStream.ReadUInt32LE()
+
+	if blobLength > rbBinaryDataProtocol.MaxBlobSize {
+		err := errors.New("[RBBinaryDataProtocol::SaveBinaryData] Blob too large")
+		go handler(err, client, callID, "", nil, nil)
+		return
+	}
+
+	if uint64(len(parametersStream.Bytes()[parametersStream.ByteOffset():])) < uint64(blobLength) {
+		err := errors.New("[RBBinaryDataProtocol::SaveBinaryData] Data too small for blob length")
+		go handler(err, client, callID, "", nil, nil)
+		return
+	}
+
+	blob := parametersStream.ReadBytesNext(int64(blobLength))
+
+	var reservation *BinaryDataReservation
+
+	if rbBinaryDataProtocol.SaveBinaryDataHandler != nil && rbBinaryDataProtocol.Quota != nil {
+		reservation, err = rbBinaryDataProtocol.Quota.Reserve(client.PID(), metadata, uint64(len(blob)))
+
+		if err != nil {
+			log.Printf("[Warning] RBBinaryDataProtocol refused %q of %d: %s\n", metadata, client.PID(), err)
+			respondErrorCode(client, RBBinaryDataProtocolID, callID, quotaResultCode(err))
+			return
+		}
+	}
+
+	go handler(nil, client, callID, metadata, blob, reservation)
 }
 
 func (rbBinaryDataProtocol *RBBinaryDataProtocol) handleGetBinaryData(packet nex.PacketInterface) {
-	if rbBinaryDataProtocol.GetBinaryDataHandler == nil {
+	handler := rbBinaryDataProtocol.GetBinaryDataHandler
+
+	if handler == nil && rbBinaryDataProtocol.BlobStore != nil {
+		handler = rbBinaryDataProtocol.defaultGetBinaryData
+	}
+
+	if handler == nil {
 		log.Println("[Warning] RBBinaryDataProtocol::GetBinaryData not implemented")
 		go respondNotImplemented(packet, RBBinaryDataProtocolID)
 		return
@@ -99,16 +181,201 @@ func (rbBinaryDataProtocol *RBBinaryDataProtocol) handleGetBinaryData(packet nex
 
 	metadata, err := parametersStream.Read4ByteString()
 	if err != nil {
-		go rbBinaryDataProtocol.GetBinaryDataHandler(err, client, callID, "")
+		go handler(err, client, callID, "")
+		return
+	}
+
+	go handler(nil, client, callID, metadata)
+}
+
+// parseDescriptor parses the metadata of a default handler call, fills in the owner of the blob
+// and responds with an error if it is invalid or the client may not write or read the blob
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) parseDescriptor(client *nex.Client, callID uint32, metadata string, write bool) (*BinaryDataDescriptor, bool) {
+	descriptor, resultCode, err := rbBinaryDataProtocol.authorizeDescriptor(client.PID(), metadata, write)
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, resultCode)
+		return nil, false
+	}
+
+	return descriptor, true
+}
+
+// authorizeDescriptor parses metadata, fills in the owner of the blob and checks that pid may write or read it.
+// On failure the result code to respond with is returned along with the error
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) authorizeDescriptor(pid uint32, metadata string, write bool) (*BinaryDataDescriptor, uint32, error) {
+	descriptor, err := ParseBinaryDataDescriptor(metadata)
+
+	if err != nil {
+		return nil, ResultCodeCoreInvalidArgument, err
+	}
+
+	if descriptor.OwnerPID == 0 {
+		descriptor.OwnerPID = pid
+	}
+
+	if descriptor.OwnerPID == pid || (!write && rbBinaryDataProtocol.PublicBinaryDataTypes[descriptor.Type]) {
+		return descriptor, ResultCodeSuccess, nil
+	}
+
+	return nil, ResultCodeCoreAccessDenied, fmt.Errorf("[RBBinaryDataProtocol::authorizeDescriptor] Refused access to %s of %d for %d", descriptor.Key(), descriptor.OwnerPID, pid)
+}
+
+// validateBlob runs the Validators and responds with an error if the blob is refused, quarantining it
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) validateBlob(client *nex.Client, callID uint32, descriptor *BinaryDataDescriptor, blob []byte) bool {
+	for _, validator := range rbBinaryDataProtocol.Validators {
+		err := validator.ValidateBinaryData(descriptor, blob)
+
+		if err == nil {
+			continue
+		}
+
+		log.Printf("[Warning] RBBinaryDataProtocol refused %s of %d: %s\n", descriptor.Key(), descriptor.OwnerPID, err)
+
+		rbBinaryDataProtocol.quarantine(descriptor.OwnerPID, blob)
+
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, ResultCodeCoreInvalidArgument)
+
+		return false
+	}
+
+	return true
+}
+
+// quarantine saves a refused blob to the Quarantine, replacing the last one refused for the player,
+// unless one was already saved for them within QuarantineInterval
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) quarantine(pid uint32, blob []byte) {
+	if rbBinaryDataProtocol.Quarantine == nil {
+		return
+	}
+
+	now := time.Now()
+
+	rbBinaryDataProtocol.quarantineMutex.Lock()
+
+	if now.Sub(rbBinaryDataProtocol.lastQuarantined[pid]) < rbBinaryDataProtocol.QuarantineInterval {
+		rbBinaryDataProtocol.quarantineMutex.Unlock()
+		return
+	}
+
+	if rbBinaryDataProtocol.lastQuarantined == nil {
+		rbBinaryDataProtocol.lastQuarantined = make(map[uint32]time.Time)
+	}
+
+	// entries older than QuarantineInterval no longer limit anything, sweep them at most once per interval
+	if now.Sub(rbBinaryDataProtocol.lastQuarantinePrune) >= rbBinaryDataProtocol.QuarantineInterval {
+		for quarantinedPID, quarantinedAt := range rbBinaryDataProtocol.lastQuarantined {
+			if now.Sub(quarantinedAt) >= rbBinaryDataProtocol.QuarantineInterval {
+				delete(rbBinaryDataProtocol.lastQuarantined, quarantinedPID)
+			}
+		}
+
+		rbBinaryDataProtocol.lastQuarantinePrune = now
+	}
+
+	rbBinaryDataProtocol.lastQuarantined[pid] = now
+	rbBinaryDataProtocol.quarantineMutex.Unlock()
+
+	if err := rbBinaryDataProtocol.Quarantine.SaveBlob(pid, QuarantineKey, blob); err != nil {
+		log.Println(err)
+	}
+}
+
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) defaultSaveBinaryData(err error, client *nex.Client, callID uint32, metadata string, blob []byte, _ *BinaryDataReservation) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, ResultCodeCoreInvalidArgument)
+		return
+	}
+
+	descriptor, ok := rbBinaryDataProtocol.parseDescriptor(client, callID, metadata, true)
+
+	if !ok {
+		return
+	}
+
+	if !rbBinaryDataProtocol.validateBlob(client, callID, descriptor, blob) {
+		return
+	}
+
+	var reservation *BinaryDataReservation
+
+	if rbBinaryDataProtocol.Quota != nil {
+		reservation, err = rbBinaryDataProtocol.Quota.Reserve(descriptor.OwnerPID, descriptor.Key(), uint64(len(blob)))
+
+		if err != nil {
+			log.Printf("[Warning] RBBinaryDataProtocol refused %s of %d: %s\n", descriptor.Key(), descriptor.OwnerPID, err)
+			respondErrorCode(client, RBBinaryDataProtocolID, callID, quotaResultCode(err))
+			return
+		}
+	}
+
+	if err := rbBinaryDataProtocol.BlobStore.SaveBlob(descriptor.OwnerPID, descriptor.Key(), blob); err != nil {
+		log.Println(err)
+
+		if reservation != nil {
+			if err := reservation.Cancel(); err != nil {
+				log.Println(err)
+			}
+		}
+
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	respondSuccess(client, RBBinaryDataProtocolID, callID, SaveBinaryData, nil)
+}
+
+func (rbBinaryDataProtocol *RBBinaryDataProtocol) defaultGetBinaryData(err error, client *nex.Client, callID uint32, metadata string) {
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, ResultCodeCoreInvalidArgument)
 		return
 	}
 
-	go rbBinaryDataProtocol.GetBinaryDataHandler(nil, client, callID, metadata)
+	descriptor, ok := rbBinaryDataProtocol.parseDescriptor(client, callID, metadata, false)
+
+	if !ok {
+		return
+	}
+
+	blob, err := rbBinaryDataProtocol.BlobStore.GetBlob(descriptor.OwnerPID, descriptor.Key())
+
+	if errors.Is(err, ErrBlobNotFound) {
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, ResultCodeCoreInvalidIndex)
+		return
+	}
+
+	if err != nil {
+		log.Println(err)
+		respondErrorCode(client, RBBinaryDataProtocolID, callID, ResultCodeCoreUnknown)
+		return
+	}
+
+	rmcResponseStream := NewStreamOut(rbBinaryDataProtocol.server)
+	rmcResponseStream.WriteBuffer(blob)
+
+	respondSuccess(client, RBBinaryDataProtocolID, callID, GetBinaryData, rmcResponseStream.Bytes())
+}
+
+// quotaResultCode returns the result code to respond with when reserving quota fails
+func quotaResultCode(err error) uint32 {
+	if errors.Is(err, ErrPlayerQuotaExceeded) || errors.Is(err, ErrGlobalQuotaExceeded) {
+		return ResultCodeRendezVousLimitExceeded
+	}
+
+	return ResultCodeCoreUnknown
 }
 
 // NewRBBinaryDataProtocol returns a new RBBinaryDataProtocol
 func NewRBBinaryDataProtocol(server *nex.Server) *RBBinaryDataProtocol {
-	rbBinaryDataProtocol := &RBBinaryDataProtocol{server: server}
+	rbBinaryDataProtocol := &RBBinaryDataProtocol{
+		server:                server,
+		MaxBlobSize:           DefaultMaxBlobSize,
+		PublicBinaryDataTypes: make(map[string]bool),
+		QuarantineInterval:    DefaultQuarantineInterval,
+	}
 
 	rbBinaryDataProtocol.Setup()
 
@@ -0,0 +1,69 @@
+package nexproto
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRBBinaryDataQuarantineIsRateLimited(t *testing.T) {
+	quarantine := NewMemoryBlobStore()
+	rbBinaryDataProtocol := &RBBinaryDataProtocol{
+		Quarantine:         quarantine,
+		QuarantineInterval: time.Hour,
+	}
+
+	steps := []struct {
+		pid  uint32
+		blob string
+		want string
+	}{
+		{1000, "first", "first"},
+		{1000, "second", "first"},
+		{1001, "other player", "other player"},
+	}
+
+	for _, step := range steps {
+		rbBinaryDataProtocol.quarantine(step.pid, []byte(step.blob))
+
+		blob, err := quarantine.GetBlob(step.pid, QuarantineKey)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(blob) != step.want {
+			t.Fatalf("quarantined %q for %d, want %q", blob, step.pid, step.want)
+		}
+	}
+
+	// once the interval has passed the player's next refused blob replaces the last one
+	rbBinaryDataProtocol.lastQuarantined[1000] = time.Now().Add(-2 * time.Hour)
+	rbBinaryDataProtocol.quarantine(1000, []byte("third"))
+
+	if blob, err := quarantine.GetBlob(1000, QuarantineKey); err != nil || string(blob) != "third" {
+		t.Fatalf("got %q, %v, want third", blob, err)
+	}
+}
+
+func TestRBBinaryDataQuarantinePrunesOldEntries(t *testing.T) {
+	rbBinaryDataProtocol := &RBBinaryDataProtocol{
+		Quarantine:         NewMemoryBlobStore(),
+		QuarantineInterval: time.Hour,
+	}
+
+	rbBinaryDataProtocol.quarantine(1000, []byte("blob"))
+	rbBinaryDataProtocol.quarantine(1001, []byte("blob"))
+
+	rbBinaryDataProtocol.lastQuarantined[1000] = time.Now().Add(-2 * time.Hour)
+	rbBinaryDataProtocol.lastQuarantinePrune = time.Now().Add(-2 * time.Hour)
+
+	rbBinaryDataProtocol.quarantine(1002, []byte("blob"))
+
+	if _, ok := rbBinaryDataProtocol.lastQuarantined[1000]; ok {
+		t.Fatal("entry older than QuarantineInterval was kept")
+	}
+
+	if len(rbBinaryDataProtocol.lastQuarantined) != 2 {
+		t.Fatalf("got %d entries, want 1001 and 1002", len(rbBinaryDataProtocol.lastQuarantined))
+	}
+}
@@ -0,0 +1,62 @@
+package nexproto
+
+import nex "github.com/ihatecompvir/nex-go"
+
+func respondError(packet nex.PacketInterface, protocolID uint8, errorCode uint32) {
+	client := packet.Sender()
+	request := packet.RMCRequest()
+
+	rmcResponse := nex.NewRMCResponse(protocolID, request.CallID())
+	rmcResponse.SetError(errorCode)
+
+	rmcResponseBytes := rmcResponse.Bytes()
+
+	var responsePacket nex.PacketInterface
+
+	responsePacket, _ = nex.NewPacketV0(client, nil)
+
+	responsePacket.SetVersion(packet.Version())
+	responsePacket.SetSource(packet.Destination())
+	responsePacket.SetDestination(packet.Source())
+	responsePacket.SetType(nex.DataPacket)
+	responsePacket.SetPayload(rmcResponseBytes)
+
+	responsePacket.AddFlag(nex.FlagNeedsAck)
+	responsePacket.AddFlag(nex.FlagReliable)
+
+	client.Server().Send(responsePacket)
+}
+
+// sendRMCResponse sends an RMC response to a client which is not tied to a received packet
+func sendRMCResponse(client *nex.Client, rmcResponse *nex.RMCResponse) {
+	rmcResponseBytes := rmcResponse.Bytes()
+
+	var responsePacket nex.PacketInterface
+
+	responsePacket, _ = nex.NewPacketV0(client, nil)
+
+	responsePacket.SetVersion(0)
+	responsePacket.SetSource(0xA1)
+	responsePacket.SetDestination(0xAF)
+	responsePacket.SetType(nex.DataPacket)
+	responsePacket.SetPayload(rmcResponseBytes)
+
+	responsePacket.AddFlag(nex.FlagNeedsAck)
+	responsePacket.AddFlag(nex.FlagReliable)
+
+	client.Server().Send(responsePacket)
+}
+
+func respondSuccess(client *nex.Client, protocolID uint8, callID uint32, methodID uint32, body []byte) {
+	rmcResponse := nex.NewRMCResponse(protocolID, callID)
+	rmcResponse.SetSuccess(methodID, body)
+
+	sendRMCResponse(client, rmcResponse)
+}
+
+func respondErrorCode(client *nex.Client, protocolID uint8, callID uint32, errorCode uint32) {
+	rmcResponse := nex.NewRMCResponse(protocolID, callID)
+	rmcResponse.SetError(errorCode)
+
+	sendRMCResponse(client, rmcResponse)
+}
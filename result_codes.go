@@ -0,0 +1,40 @@
+package nexproto
+
+// Quazal result codes used in RMC error responses
+const (
+	// ResultCodeSuccess is the result code of a successful operation
+	ResultCodeSuccess = 0x00010001
+
+	// ResultCodeCoreUnknown is returned when the server failed for a reason the client can't act on
+	ResultCodeCoreUnknown = 0x80010001
+
+	// ResultCodeCoreNotImplemented is returned for methods without a handler
+	ResultCodeCoreNotImplemented = 0x80010002
+
+	// ResultCodeCoreAccessDenied is returned when a request is refused, e.g. while backing off failed logins
+	ResultCodeCoreAccessDenied = 0x80010006
+
+	// ResultCodeCoreInvalidIndex is returned when a requested item does not exist
+	ResultCodeCoreInvalidIndex = 0x80010008
+
+	// ResultCodeCoreInvalidArgument is returned when request parameters could not be decoded
+	ResultCodeCoreInvalidArgument = 0x8001000A
+
+	// ResultCodeRendezVousInvalidUsername is returned when no account has the given username
+	ResultCodeRendezVousInvalidUsername = 0x80030064
+
+	// ResultCodeRendezVousInvalidPassword is returned when a password or token does not match
+	ResultCodeRendezVousInvalidPassword = 0x80030065
+
+	// ResultCodeRendezVousUsernameAlreadyExists is returned when an account with the given name already exists
+	ResultCodeRendezVousUsernameAlreadyExists = 0x80030066
+
+	// ResultCodeRendezVousInvalidPID is returned when no account has the given PID
+	ResultCodeRendezVousInvalidPID = 0x8003006B
+
+	// ResultCodeRendezVousLimitExceeded is returned when a request would go over a limit, e.g. a storage quota
+	ResultCodeRendezVousLimitExceeded = 0x800300DF
+
+	// ResultCodeRendezVousAccountTemporarilyDisabled is returned while logins are locked out after too many failures
+	ResultCodeRendezVousAccountTemporarilyDisabled = 0x800300E0
+)
@@ -3,6 +3,7 @@ package nexproto
 import (
 	"errors"
 	"log"
+	"time"
 
 	nex "github.com/ihatecompvir/nex-go"
 )
@@ -48,6 +49,7 @@ type SecureProtocol struct {
 	UpdateURLsHandler            func(err error, client *nex.Client, callID uint32, stationUrls []*nex.StationURL)
 	ReplaceURLHandler            func(err error, client *nex.Client, callID uint32, oldStation *nex.StationURL, newStation *nex.StationURL)
 	SendReportHandler            func(err error, client *nex.Client, callID uint32, reportID uint32, report []byte)
+	TicketStore                  TicketStore
 }
 
 // Setup initializes the protocol
@@ -386,6 +388,43 @@ func (secureProtocol *SecureProtocol) handleSendReport(packet nex.PacketInterfac
 	go secureProtocol.SendReportHandler(nil, client, callID, reportID, report)
 }
 
+// VerifyConnect verifies a CONNECT payload like VerifyConnectPayload, and when a TicketStore is set
+// also refuses tickets which the authentication server never issued, has revoked or which have expired
+func (secureProtocol *SecureProtocol) VerifyConnect(payload []byte, serverKey []byte) (*ConnectData, error) {
+	connectData, err := VerifyConnectPayload(payload, serverKey, secureProtocol.server.KerberosKeySize())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if secureProtocol.TicketStore == nil {
+		return connectData, nil
+	}
+
+	issuedTicket, err := secureProtocol.TicketStore.LookupTicket(connectData.SessionKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if issuedTicket.Revoked {
+		return nil, ErrTicketRevoked
+	}
+
+	if issuedTicket.UserPID != connectData.UserPID {
+		return nil, &ConnectPIDMismatchError{
+			TicketPID:  issuedTicket.UserPID,
+			RequestPID: connectData.UserPID,
+		}
+	}
+
+	if !time.Now().Before(issuedTicket.Expiration) {
+		return nil, ErrKerberosTicketExpired
+	}
+
+	return connectData, nil
+}
+
 // NewSecureProtocol returns a new SecureProtocol
 func NewSecureProtocol(server *nex.Server) *SecureProtocol {
 	secureProtocol := &SecureProtocol{
@@ -1,6 +1,8 @@
 package nexproto
 
 import (
+	"errors"
+
 	nex "github.com/ihatecompvir/nex-go"
 )
 
@@ -47,6 +49,109 @@ func (stream *StreamIn) ReadListStationURL() ([]*nex.StationURL, error) {
 	return stationUrls, nil
 }
 
+// ReadDataHolder reads a data holder, the name of the held class followed by its content
+func (stream *StreamIn) ReadDataHolder() (*DataHolder, error) {
+	dataHolderName, err := stream.Read4ByteString()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stream.Bytes()[stream.ByteOffset():]) < 8 {
+		return nil, errors.New("[StreamIn::ReadDataHolder] Data holder missing lengths")
+	}
+
+	_ = stream.ReadUInt32LE() // length including next buffer length field
+
+	dataHolderContent, err := stream.ReadBuffer()
+
+	if err != nil {
+		return nil, err
+	}
+
+	dataHolder := &DataHolder{
+		Name: dataHolderName,
+		Data: dataHolderContent,
+	}
+
+	return dataHolder, nil
+}
+
+// ReadResultRange reads a ResultRange structure
+func (stream *StreamIn) ReadResultRange() (*ResultRange, error) {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 8 {
+		return nil, errors.New("[StreamIn::ReadResultRange] Data too small")
+	}
+
+	resultRange := &ResultRange{
+		Offset: stream.ReadUInt32LE(),
+		Size:   stream.ReadUInt32LE(),
+	}
+
+	return resultRange, nil
+}
+
+// ReadListUInt32LE reads a list of uint32 values
+func (stream *StreamIn) ReadListUInt32LE() ([]uint32, error) {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 4 {
+		return nil, errors.New("[StreamIn::ReadListUInt32LE] Data missing list length")
+	}
+
+	length := stream.ReadUInt32LE()
+
+	if uint64(len(stream.Bytes()[stream.ByteOffset():])) < uint64(length)*4 {
+		return nil, errors.New("[StreamIn::ReadListUInt32LE] Data too small for list length")
+	}
+
+	list := make([]uint32, 0, length)
+
+	for i := 0; i < int(length); i++ {
+		list = append(list, stream.ReadUInt32LE())
+	}
+
+	return list, nil
+}
+
+// ReadMessageRecipient reads a MessageRecipient structure
+func (stream *StreamIn) ReadMessageRecipient() (*MessageRecipient, error) {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 8 {
+		return nil, errors.New("[StreamIn::ReadMessageRecipient] Data too small")
+	}
+
+	messageRecipient := &MessageRecipient{
+		ID:            stream.ReadUInt32LE(),
+		RecipientType: stream.ReadUInt32LE(),
+	}
+
+	return messageRecipient, nil
+}
+
+// ReadListMessageRecipient reads a list of MessageRecipient structures
+func (stream *StreamIn) ReadListMessageRecipient() ([]*MessageRecipient, error) {
+	if len(stream.Bytes()[stream.ByteOffset():]) < 4 {
+		return nil, errors.New("[StreamIn::ReadListMessageRecipient] Data missing list length")
+	}
+
+	length := stream.ReadUInt32LE()
+
+	if uint64(len(stream.Bytes()[stream.ByteOffset():])) < uint64(length)*8 {
+		return nil, errors.New("[StreamIn::ReadListMessageRecipient] Data too small for list length")
+	}
+
+	messageRecipients := make([]*MessageRecipient, 0, length)
+
+	for i := 0; i < int(length); i++ {
+		messageRecipient, err := stream.ReadMessageRecipient()
+		if err != nil {
+			return nil, err
+		}
+
+		messageRecipients = append(messageRecipients, messageRecipient)
+	}
+
+	return messageRecipients, nil
+}
+
 // NewStreamIn returns a new nexproto output stream
 func NewStreamIn(data []byte, server *nex.Server) *StreamIn {
 	return &StreamIn{
@@ -0,0 +1,33 @@
+package nexproto
+
+import (
+	nex "github.com/ihatecompvir/nex-go"
+)
+
+// StreamOut is an abstraction of StreamOut from github.com/ihatecompvir/nex-go
+// Adds the 4 byte length strings used by Rock Band 3
+type StreamOut struct {
+	*nex.StreamOut
+}
+
+// Write4ByteString writes a null terminated string with a 4 byte length, the counterpart of Read4ByteString
+func (stream *StreamOut) Write4ByteString(value string) {
+	stream.WriteUInt32LE(uint32(len(value) + 1))
+
+	stream.Grow(int64(len(value) + 1))
+	stream.WriteBytesNext(append([]byte(value), 0))
+}
+
+// WriteDataHolder writes a data holder, the counterpart of ReadDataHolder
+func (stream *StreamOut) WriteDataHolder(dataHolder *DataHolder) {
+	stream.Write4ByteString(dataHolder.Name)
+	stream.WriteUInt32LE(uint32(len(dataHolder.Data) + 4))
+	stream.WriteBuffer(dataHolder.Data)
+}
+
+// NewStreamOut returns a new nexproto output stream
+func NewStreamOut(server *nex.Server) *StreamOut {
+	return &StreamOut{
+		StreamOut: nex.NewStreamOut(server),
+	}
+}
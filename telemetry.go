@@ -0,0 +1,223 @@
+package nexproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	nex "github.com/ihatecompvir/nex-go"
+)
+
+// Default TelemetryPipeline settings
+const (
+	DefaultTelemetryBatchSize     = 100
+	DefaultTelemetryFlushInterval = 5 * time.Second
+	DefaultTelemetryQueueSize     = 10000
+)
+
+// TelemetryEvent holds one event sent through JsonRequest2
+type TelemetryEvent struct {
+	PID        uint32          `json:"pid"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// TelemetrySink stores batches of telemetry events
+type TelemetrySink interface {
+	WriteEvents(events []*TelemetryEvent) error
+	Close() error
+}
+
+// TelemetryPipeline collects the telemetry events sent through JsonRequest2 and writes them to a TelemetrySink in batches.
+// Clients are acknowledged before their events are even parsed. Only SampleRate of the requests are kept,
+// and events are dropped rather than queued when the sink can't keep up
+type TelemetryPipeline struct {
+	SampleRate float64
+
+	sink          TelemetrySink
+	batchSize     int
+	flushInterval time.Duration
+	queue         chan *TelemetryEvent
+	done          chan struct{}
+	stopped       chan struct{}
+	closeOnce     sync.Once
+	closeErr      error
+	dropped       uint64
+	sampledOut    uint64
+}
+
+// HandleJSONRequest2 is a JSONRequest2 handler which acknowledges the request and queues its events
+func (telemetryPipeline *TelemetryPipeline) HandleJSONRequest2(err error, client *nex.Client, callID uint32, rawJson string) {
+	respondSuccess(client, JsonProtocolID, callID, JsonRequest2, nil)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if telemetryPipeline.SampleRate < 1 && rand.Float64() >= telemetryPipeline.SampleRate {
+		atomic.AddUint64(&telemetryPipeline.sampledOut, 1)
+		return
+	}
+
+	events, err := parseTelemetryEvents(rawJson)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, data := range events {
+		telemetryPipeline.Enqueue(&TelemetryEvent{
+			PID:        client.PID(),
+			ReceivedAt: now,
+			Data:       data,
+		})
+	}
+}
+
+// Enqueue queues an event for the sink, dropping it if the queue is full or the pipeline is closed
+func (telemetryPipeline *TelemetryPipeline) Enqueue(event *TelemetryEvent) {
+	select {
+	case <-telemetryPipeline.done:
+		atomic.AddUint64(&telemetryPipeline.dropped, 1)
+		return
+	default:
+	}
+
+	select {
+	case telemetryPipeline.queue <- event:
+	default:
+		atomic.AddUint64(&telemetryPipeline.dropped, 1)
+	}
+}
+
+// Dropped returns how many events were dropped because the queue was full
+func (telemetryPipeline *TelemetryPipeline) Dropped() uint64 {
+	return atomic.LoadUint64(&telemetryPipeline.dropped)
+}
+
+// SampledOut returns how many requests were skipped by sampling
+func (telemetryPipeline *TelemetryPipeline) SampledOut() uint64 {
+	return atomic.LoadUint64(&telemetryPipeline.sampledOut)
+}
+
+// Close writes the queued events to the sink and closes it. Closing more than once does nothing
+func (telemetryPipeline *TelemetryPipeline) Close() error {
+	telemetryPipeline.closeOnce.Do(func() {
+		close(telemetryPipeline.done)
+		<-telemetryPipeline.stopped
+
+		telemetryPipeline.closeErr = telemetryPipeline.sink.Close()
+	})
+
+	return telemetryPipeline.closeErr
+}
+
+func (telemetryPipeline *TelemetryPipeline) run() {
+	defer close(telemetryPipeline.stopped)
+
+	ticker := time.NewTicker(telemetryPipeline.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*TelemetryEvent, 0, telemetryPipeline.batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := telemetryPipeline.sink.WriteEvents(batch); err != nil {
+			log.Println(err)
+		}
+
+		batch = make([]*TelemetryEvent, 0, telemetryPipeline.batchSize)
+	}
+
+	for {
+		select {
+		case event := <-telemetryPipeline.queue:
+			batch = append(batch, event)
+
+			if len(batch) >= telemetryPipeline.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-telemetryPipeline.done:
+			for {
+				select {
+				case event := <-telemetryPipeline.queue:
+					batch = append(batch, event)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// NewTelemetryPipeline returns a new TelemetryPipeline writing to sink and starts it.
+// Events are written once batchSize of them are queued or flushInterval has passed.
+// queueSize events can wait for the sink before new ones are dropped.
+// Values of 0 or less use the DefaultTelemetry settings
+func NewTelemetryPipeline(sink TelemetrySink, batchSize int, flushInterval time.Duration, queueSize int) *TelemetryPipeline {
+	if batchSize <= 0 {
+		batchSize = DefaultTelemetryBatchSize
+	}
+
+	if flushInterval <= 0 {
+		flushInterval = DefaultTelemetryFlushInterval
+	}
+
+	if queueSize <= 0 {
+		queueSize = DefaultTelemetryQueueSize
+	}
+
+	telemetryPipeline := &TelemetryPipeline{
+		SampleRate:    1,
+		sink:          sink,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		queue:         make(chan *TelemetryEvent, queueSize),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+
+	go telemetryPipeline.run()
+
+	return telemetryPipeline
+}
+
+// parseTelemetryEvents splits a JsonRequest2 payload into events. The payload is either one event or an array of events
+func parseTelemetryEvents(rawJson string) ([]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace([]byte(rawJson))
+
+	if len(trimmed) == 0 {
+		return nil, errors.New("[TelemetryPipeline] Empty telemetry")
+	}
+
+	if trimmed[0] != '[' {
+		if !json.Valid(trimmed) {
+			return nil, errors.New("[TelemetryPipeline] Invalid telemetry JSON")
+		}
+
+		return []json.RawMessage{trimmed}, nil
+	}
+
+	var events []json.RawMessage
+
+	if err := json.Unmarshal(trimmed, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
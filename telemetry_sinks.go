@@ -0,0 +1,231 @@
+package nexproto
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterTelemetrySink is a TelemetrySink which writes events to an io.Writer as JSON lines
+type WriterTelemetrySink struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// WriteEvents writes a batch of events, one JSON object per line
+func (writerTelemetrySink *WriterTelemetrySink) WriteEvents(events []*TelemetryEvent) error {
+	writerTelemetrySink.mutex.Lock()
+	defer writerTelemetrySink.mutex.Unlock()
+
+	_, err := writeTelemetryLines(writerTelemetrySink.writer, events)
+
+	return err
+}
+
+// Close does nothing, the writer is owned by the caller
+func (writerTelemetrySink *WriterTelemetrySink) Close() error {
+	return nil
+}
+
+// NewWriterTelemetrySink returns a new WriterTelemetrySink writing to writer
+func NewWriterTelemetrySink(writer io.Writer) *WriterTelemetrySink {
+	return &WriterTelemetrySink{writer: writer}
+}
+
+// NewStdoutTelemetrySink returns a new WriterTelemetrySink writing to standard output
+func NewStdoutTelemetrySink() *WriterTelemetrySink {
+	return NewWriterTelemetrySink(os.Stdout)
+}
+
+// JSONLTelemetrySink is a TelemetrySink which appends events to a JSON lines file.
+// Once the file reaches MaxSize bytes it is renamed with a timestamp suffix and a new file is started
+type JSONLTelemetrySink struct {
+	MaxSize int64
+
+	mutex  sync.Mutex
+	path   string
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// WriteEvents appends a batch of events, one JSON object per line
+func (jsonlTelemetrySink *JSONLTelemetrySink) WriteEvents(events []*TelemetryEvent) error {
+	jsonlTelemetrySink.mutex.Lock()
+	defer jsonlTelemetrySink.mutex.Unlock()
+
+	if jsonlTelemetrySink.closed {
+		return os.ErrClosed
+	}
+
+	// keep appending to the current file if it can't be rotated, rotation is retried on the next batch
+	if jsonlTelemetrySink.MaxSize > 0 && jsonlTelemetrySink.size >= jsonlTelemetrySink.MaxSize {
+		if err := jsonlTelemetrySink.rotate(); err != nil {
+			log.Println(err)
+		}
+	}
+
+	written, err := writeTelemetryLines(jsonlTelemetrySink.file, events)
+	jsonlTelemetrySink.size += written
+
+	return err
+}
+
+// Close closes the file. Closing more than once does nothing
+func (jsonlTelemetrySink *JSONLTelemetrySink) Close() error {
+	jsonlTelemetrySink.mutex.Lock()
+	defer jsonlTelemetrySink.mutex.Unlock()
+
+	if jsonlTelemetrySink.closed {
+		return nil
+	}
+
+	jsonlTelemetrySink.closed = true
+
+	return jsonlTelemetrySink.file.Close()
+}
+
+// rotate renames the current file out of the way and opens a new one.
+// The current file stays open if either step fails. Must be called with mutex held
+func (jsonlTelemetrySink *JSONLTelemetrySink) rotate() error {
+	rotatedPath := fmt.Sprintf("%s.%s", jsonlTelemetrySink.path, time.Now().UTC().Format("20060102T150405.000000000"))
+
+	// the file is already gone when a previous rotation renamed it but failed to open the new one
+	if err := os.Rename(jsonlTelemetrySink.path, rotatedPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// the old handle keeps appending to the renamed file until the new one is open
+	oldFile := jsonlTelemetrySink.file
+
+	if err := jsonlTelemetrySink.open(); err != nil {
+		return err
+	}
+
+	return oldFile.Close()
+}
+
+// open opens the file for appending. Must be called with mutex held
+func (jsonlTelemetrySink *JSONLTelemetrySink) open() error {
+	file, err := os.OpenFile(jsonlTelemetrySink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	fileInfo, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	jsonlTelemetrySink.file = file
+	jsonlTelemetrySink.size = fileInfo.Size()
+
+	return nil
+}
+
+// NewJSONLTelemetrySink returns a new JSONLTelemetrySink appending to path and rotating it at maxSize bytes, 0 to never rotate
+func NewJSONLTelemetrySink(path string, maxSize int64) (*JSONLTelemetrySink, error) {
+	jsonlTelemetrySink := &JSONLTelemetrySink{
+		MaxSize: maxSize,
+		path:    path,
+	}
+
+	if err := jsonlTelemetrySink.open(); err != nil {
+		return nil, err
+	}
+
+	return jsonlTelemetrySink, nil
+}
+
+// SQLTelemetrySink is a TelemetrySink which inserts events into a database/sql table.
+// Queries only use plain SQL with ? placeholders so any SQLite driver works
+type SQLTelemetrySink struct {
+	database *sql.DB
+}
+
+// WriteEvents inserts a batch of events in one transaction
+func (sqlTelemetrySink *SQLTelemetrySink) WriteEvents(events []*TelemetryEvent) error {
+	transaction, err := sqlTelemetrySink.database.Begin()
+
+	if err != nil {
+		return err
+	}
+
+	statement, err := transaction.Prepare("INSERT INTO nex_telemetry (pid, received_at, data) VALUES (?, ?, ?)")
+
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	defer statement.Close()
+
+	for _, event := range events {
+		if _, err := statement.Exec(event.PID, event.ReceivedAt.Unix(), string(event.Data)); err != nil {
+			transaction.Rollback()
+			return err
+		}
+	}
+
+	return transaction.Commit()
+}
+
+// Close does nothing, the database is owned by the caller
+func (sqlTelemetrySink *SQLTelemetrySink) Close() error {
+	return nil
+}
+
+// NewSQLTelemetrySink returns a new SQLTelemetrySink, creating the nex_telemetry table if it does not exist
+func NewSQLTelemetrySink(database *sql.DB) (*SQLTelemetrySink, error) {
+	_, err := database.Exec(`CREATE TABLE IF NOT EXISTS nex_telemetry (
+		pid INTEGER NOT NULL,
+		received_at INTEGER NOT NULL,
+		data TEXT NOT NULL
+	)`)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLTelemetrySink{database: database}, nil
+}
+
+// writeTelemetryLines writes events as JSON lines, returning how many bytes were written
+func writeTelemetryLines(writer io.Writer, events []*TelemetryEvent) (int64, error) {
+	countingWriter := &countingWriter{writer: writer}
+	bufferedWriter := bufio.NewWriter(countingWriter)
+	encoder := json.NewEncoder(bufferedWriter)
+
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			bufferedWriter.Flush()
+			return countingWriter.written, err
+		}
+	}
+
+	err := bufferedWriter.Flush()
+
+	return countingWriter.written, err
+}
+
+type countingWriter struct {
+	writer  io.Writer
+	written int64
+}
+
+func (countingWriter *countingWriter) Write(data []byte) (int, error) {
+	written, err := countingWriter.writer.Write(data)
+	countingWriter.written += int64(written)
+
+	return written, err
+}
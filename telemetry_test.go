@@ -0,0 +1,253 @@
+package nexproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingWriter signals entered on its first write and waits for release before writing
+type blockingWriter struct {
+	buffer  bytes.Buffer
+	entered chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (blockingWriter *blockingWriter) Write(data []byte) (int, error) {
+	blockingWriter.once.Do(func() {
+		close(blockingWriter.entered)
+		<-blockingWriter.release
+	})
+
+	return blockingWriter.buffer.Write(data)
+}
+
+func testTelemetryEvent(pid uint32) *TelemetryEvent {
+	return &TelemetryEvent{PID: pid, ReceivedAt: time.Unix(0, 0).UTC(), Data: json.RawMessage(`{}`)}
+}
+
+// telemetryLines returns the lines written to a WriterTelemetrySink so far
+func telemetryLines(writerTelemetrySink *WriterTelemetrySink, buffer *bytes.Buffer) []string {
+	writerTelemetrySink.mutex.Lock()
+	defer writerTelemetrySink.mutex.Unlock()
+
+	return strings.Split(strings.TrimSpace(buffer.String()), "\n")
+}
+
+func TestTelemetryPipelineBatching(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	sink := NewWriterTelemetrySink(buffer)
+	telemetryPipeline := NewTelemetryPipeline(sink, 3, time.Hour, 10)
+	defer telemetryPipeline.Close()
+
+	telemetryPipeline.Enqueue(testTelemetryEvent(1))
+	telemetryPipeline.Enqueue(testTelemetryEvent(2))
+
+	time.Sleep(20 * time.Millisecond)
+
+	if lines := telemetryLines(sink, buffer); lines[0] != "" {
+		t.Fatalf("events written before the batch was full: %q", lines)
+	}
+
+	telemetryPipeline.Enqueue(testTelemetryEvent(3))
+
+	deadline := time.Now().Add(time.Second)
+
+	for len(telemetryLines(sink, buffer)) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("full batch not written, got %q", telemetryLines(sink, buffer))
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTelemetryPipelineFlushInterval(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	sink := NewWriterTelemetrySink(buffer)
+	telemetryPipeline := NewTelemetryPipeline(sink, 100, 10*time.Millisecond, 10)
+	defer telemetryPipeline.Close()
+
+	telemetryPipeline.Enqueue(testTelemetryEvent(1))
+
+	deadline := time.Now().Add(time.Second)
+
+	for len(telemetryLines(sink, buffer)) != 1 || telemetryLines(sink, buffer)[0] == "" {
+		if time.Now().After(deadline) {
+			t.Fatal("event not written after the flush interval")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTelemetryPipelineFlushOnClose(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	sink := NewWriterTelemetrySink(buffer)
+	telemetryPipeline := NewTelemetryPipeline(sink, 100, time.Hour, 10)
+
+	for pid := uint32(1); pid <= 5; pid++ {
+		telemetryPipeline.Enqueue(testTelemetryEvent(pid))
+	}
+
+	if err := telemetryPipeline.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := telemetryLines(sink, buffer)
+
+	if len(lines) != 5 {
+		t.Fatalf("got %d events, want 5", len(lines))
+	}
+
+	event := &TelemetryEvent{}
+
+	if err := json.Unmarshal([]byte(lines[4]), event); err != nil || event.PID != 5 {
+		t.Fatalf("unexpected last event %q: %v", lines[4], err)
+	}
+
+	telemetryPipeline.Enqueue(testTelemetryEvent(6))
+
+	if telemetryPipeline.Dropped() != 1 {
+		t.Fatalf("got %d dropped, want the event enqueued after close", telemetryPipeline.Dropped())
+	}
+
+	if err := telemetryPipeline.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
+
+func TestTelemetryPipelineDropsWhenOverloaded(t *testing.T) {
+	writer := &blockingWriter{entered: make(chan struct{}), release: make(chan struct{})}
+	sink := NewWriterTelemetrySink(writer)
+	telemetryPipeline := NewTelemetryPipeline(sink, 1, time.Hour, 1)
+
+	// the first event is taken from the queue and blocks the sink
+	telemetryPipeline.Enqueue(testTelemetryEvent(1))
+	<-writer.entered
+
+	telemetryPipeline.Enqueue(testTelemetryEvent(2))
+	telemetryPipeline.Enqueue(testTelemetryEvent(3))
+	telemetryPipeline.Enqueue(testTelemetryEvent(4))
+
+	if telemetryPipeline.Dropped() != 2 {
+		t.Fatalf("got %d dropped, want 2", telemetryPipeline.Dropped())
+	}
+
+	close(writer.release)
+
+	if err := telemetryPipeline.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Split(strings.TrimSpace(writer.buffer.String()), "\n"); len(lines) != 2 {
+		t.Fatalf("got %d events, want 2", len(lines))
+	}
+}
+
+func TestNewTelemetryPipelineDefaults(t *testing.T) {
+	telemetryPipeline := NewTelemetryPipeline(NewWriterTelemetrySink(&bytes.Buffer{}), 0, -time.Second, 0)
+
+	if telemetryPipeline.batchSize != DefaultTelemetryBatchSize {
+		t.Fatalf("got batch size %d", telemetryPipeline.batchSize)
+	}
+
+	if telemetryPipeline.flushInterval != DefaultTelemetryFlushInterval {
+		t.Fatalf("got flush interval %v", telemetryPipeline.flushInterval)
+	}
+
+	if cap(telemetryPipeline.queue) != DefaultTelemetryQueueSize {
+		t.Fatalf("got queue size %d", cap(telemetryPipeline.queue))
+	}
+
+	if err := telemetryPipeline.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseTelemetryEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawJson string
+		events  int
+		wantErr bool
+	}{
+		{"single event", `{"type":"song_start"}`, 1, false},
+		{"array of events", `[{"type":"a"},{"type":"b"}]`, 2, false},
+		{"surrounding whitespace", "  {\"type\":\"a\"}\n", 1, false},
+		{"empty array", `[]`, 0, false},
+		{"empty", "", 0, true},
+		{"whitespace only", "   ", 0, true},
+		{"invalid event", `{"type":`, 0, true},
+		{"invalid array", `[{"type":"a"}`, 0, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			events, err := parseTelemetryEvents(test.rawJson)
+
+			if test.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(events) != test.events {
+				t.Fatalf("got %d events, want %d", len(events), test.events)
+			}
+		})
+	}
+}
+
+func TestJSONLTelemetrySinkRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "telemetry.jsonl")
+	sink, err := NewJSONLTelemetrySink(path, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.WriteEvents([]*TelemetryEvent{testTelemetryEvent(1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.WriteEvents([]*TelemetryEvent{testTelemetryEvent(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := filepath.Glob(path + ".*")
+
+	if err != nil || len(rotated) != 1 {
+		t.Fatalf("got rotated files %q: %v", rotated, err)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil || strings.Count(string(data), "\n") != 1 {
+		t.Fatalf("unexpected current file %q: %v", data, err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+
+	if err := sink.WriteEvents([]*TelemetryEvent{testTelemetryEvent(3)}); err == nil {
+		t.Fatal("expected an error writing to a closed sink")
+	}
+}
@@ -0,0 +1,411 @@
+package nexproto
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// fileLockTimeout is how long to wait for another process to release a lock file
+	fileLockTimeout = 10 * time.Second
+
+	// fileLockStaleAge is how old a lock file must be before it is assumed to be left behind by a crashed process
+	fileLockStaleAge = 30 * time.Second
+)
+
+var (
+	// ErrTicketNotFound is returned when a ticket was never issued or has already been cleaned up
+	ErrTicketNotFound = errors.New("[TicketStore] Ticket not found")
+
+	// ErrTicketRevoked is returned when a ticket has been revoked
+	ErrTicketRevoked = errors.New("[TicketStore] Ticket has been revoked")
+)
+
+// IssuedTicket holds what the authentication server knows about a ticket it handed out
+type IssuedTicket struct {
+	UserPID    uint32
+	ServerPID  uint32
+	SessionKey []byte
+	Expiration time.Time
+	Revoked    bool
+}
+
+// TicketStore records issued tickets so the Secure server can refuse unknown, revoked or expired ones.
+// Tickets are looked up by their session key
+type TicketStore interface {
+	AddTicket(ticket *IssuedTicket) error
+	LookupTicket(sessionKey []byte) (*IssuedTicket, error)
+	RevokeTicket(sessionKey []byte) error
+	RevokeTicketsForPID(pid uint32) error
+	CleanupTickets(now time.Time) (int, error)
+}
+
+// MemoryTicketStore is a TicketStore which keeps tickets in memory
+type MemoryTicketStore struct {
+	mutex   sync.RWMutex
+	tickets map[string]*IssuedTicket
+}
+
+// AddTicket records an issued ticket
+func (memoryTicketStore *MemoryTicketStore) AddTicket(ticket *IssuedTicket) error {
+	memoryTicketStore.mutex.Lock()
+	defer memoryTicketStore.mutex.Unlock()
+
+	ticketCopy := *ticket
+	memoryTicketStore.tickets[hex.EncodeToString(ticket.SessionKey)] = &ticketCopy
+
+	return nil
+}
+
+// LookupTicket returns the ticket issued with the given session key
+func (memoryTicketStore *MemoryTicketStore) LookupTicket(sessionKey []byte) (*IssuedTicket, error) {
+	memoryTicketStore.mutex.RLock()
+	defer memoryTicketStore.mutex.RUnlock()
+
+	ticket, ok := memoryTicketStore.tickets[hex.EncodeToString(sessionKey)]
+
+	if !ok {
+		return nil, ErrTicketNotFound
+	}
+
+	ticketCopy := *ticket
+
+	return &ticketCopy, nil
+}
+
+// RevokeTicket revokes the ticket issued with the given session key
+func (memoryTicketStore *MemoryTicketStore) RevokeTicket(sessionKey []byte) error {
+	memoryTicketStore.mutex.Lock()
+	defer memoryTicketStore.mutex.Unlock()
+
+	ticket, ok := memoryTicketStore.tickets[hex.EncodeToString(sessionKey)]
+
+	if !ok {
+		return ErrTicketNotFound
+	}
+
+	ticket.Revoked = true
+
+	return nil
+}
+
+// RevokeTicketsForPID revokes every ticket issued to a user
+func (memoryTicketStore *MemoryTicketStore) RevokeTicketsForPID(pid uint32) error {
+	memoryTicketStore.mutex.Lock()
+	defer memoryTicketStore.mutex.Unlock()
+
+	for _, ticket := range memoryTicketStore.tickets {
+		if ticket.UserPID == pid {
+			ticket.Revoked = true
+		}
+	}
+
+	return nil
+}
+
+// CleanupTickets removes every ticket which has expired by now, returning how many were removed
+func (memoryTicketStore *MemoryTicketStore) CleanupTickets(now time.Time) (int, error) {
+	memoryTicketStore.mutex.Lock()
+	defer memoryTicketStore.mutex.Unlock()
+
+	removed := 0
+
+	for key, ticket := range memoryTicketStore.tickets {
+		if !now.Before(ticket.Expiration) {
+			delete(memoryTicketStore.tickets, key)
+			removed++
+		}
+	}
+
+	return removed, nil
+}
+
+// NewMemoryTicketStore returns a new MemoryTicketStore
+func NewMemoryTicketStore() *MemoryTicketStore {
+	return &MemoryTicketStore{
+		tickets: make(map[string]*IssuedTicket),
+	}
+}
+
+// FileTicketStore is a TicketStore which keeps tickets in memory and writes them to a JSON file on every change.
+// Lookups pick up tickets written by other processes, so the authentication and Secure servers can share one file.
+// Writes hold a lock file next to the file so processes writing at the same time don't lose each other's tickets
+type FileTicketStore struct {
+	*MemoryTicketStore
+	path      string
+	fileMutex sync.Mutex
+	fileInfo  os.FileInfo
+}
+
+// AddTicket records an issued ticket
+func (fileTicketStore *FileTicketStore) AddTicket(ticket *IssuedTicket) error {
+	return fileTicketStore.update(func() (bool, error) {
+		return true, fileTicketStore.MemoryTicketStore.AddTicket(ticket)
+	})
+}
+
+// LookupTicket returns the ticket issued with the given session key
+func (fileTicketStore *FileTicketStore) LookupTicket(sessionKey []byte) (*IssuedTicket, error) {
+	if err := fileTicketStore.reload(); err != nil {
+		return nil, err
+	}
+
+	return fileTicketStore.MemoryTicketStore.LookupTicket(sessionKey)
+}
+
+// RevokeTicket revokes the ticket issued with the given session key
+func (fileTicketStore *FileTicketStore) RevokeTicket(sessionKey []byte) error {
+	return fileTicketStore.update(func() (bool, error) {
+		return true, fileTicketStore.MemoryTicketStore.RevokeTicket(sessionKey)
+	})
+}
+
+// RevokeTicketsForPID revokes every ticket issued to a user
+func (fileTicketStore *FileTicketStore) RevokeTicketsForPID(pid uint32) error {
+	return fileTicketStore.update(func() (bool, error) {
+		return true, fileTicketStore.MemoryTicketStore.RevokeTicketsForPID(pid)
+	})
+}
+
+// CleanupTickets removes every ticket which has expired by now, returning how many were removed
+func (fileTicketStore *FileTicketStore) CleanupTickets(now time.Time) (int, error) {
+	removed := 0
+
+	err := fileTicketStore.update(func() (bool, error) {
+		var err error
+		removed, err = fileTicketStore.MemoryTicketStore.CleanupTickets(now)
+
+		return removed > 0, err
+	})
+
+	return removed, err
+}
+
+// reload merges in the tickets from the file if it was changed since it was last read or written
+func (fileTicketStore *FileTicketStore) reload() error {
+	fileTicketStore.fileMutex.Lock()
+	defer fileTicketStore.fileMutex.Unlock()
+
+	return fileTicketStore.merge(false)
+}
+
+// update applies change to the tickets while holding the lock file, between merging in the tickets
+// written by other processes and writing the file, so no process loses the changes of another.
+// The file is only written if change reports it changed something
+func (fileTicketStore *FileTicketStore) update(change func() (bool, error)) error {
+	fileTicketStore.fileMutex.Lock()
+	defer fileTicketStore.fileMutex.Unlock()
+
+	unlock, err := lockFile(fileTicketStore.path)
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	if err := fileTicketStore.merge(true); err != nil {
+		return err
+	}
+
+	changed, err := change()
+
+	if err != nil || !changed {
+		return err
+	}
+
+	fileTicketStore.mutex.RLock()
+	tickets := make([]*IssuedTicket, 0, len(fileTicketStore.tickets))
+	for _, ticket := range fileTicketStore.tickets {
+		tickets = append(tickets, ticket)
+	}
+	data, err := json.Marshal(tickets)
+	fileTicketStore.mutex.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(fileTicketStore.path, data); err != nil {
+		return err
+	}
+
+	if fileInfo, err := os.Stat(fileTicketStore.path); err == nil {
+		fileTicketStore.fileInfo = fileInfo
+	}
+
+	return nil
+}
+
+// merge reads the file into memory, keeping unexpired tickets missing from memory and revocations from either side.
+// Must be called with fileMutex held
+func (fileTicketStore *FileTicketStore) merge(force bool) error {
+	fileInfo, err := os.Stat(fileTicketStore.path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !force && fileTicketStore.unchanged(fileInfo) {
+		return nil
+	}
+
+	data, err := os.ReadFile(fileTicketStore.path)
+
+	if err != nil {
+		return err
+	}
+
+	var tickets []*IssuedTicket
+
+	if err := json.Unmarshal(data, &tickets); err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	fileTicketStore.mutex.Lock()
+	defer fileTicketStore.mutex.Unlock()
+
+	for _, ticket := range tickets {
+		key := hex.EncodeToString(ticket.SessionKey)
+
+		if existing, ok := fileTicketStore.tickets[key]; ok {
+			existing.Revoked = existing.Revoked || ticket.Revoked
+		} else if now.Before(ticket.Expiration) {
+			fileTicketStore.tickets[key] = ticket
+		}
+	}
+
+	fileTicketStore.fileInfo = fileInfo
+
+	return nil
+}
+
+// unchanged checks if the file is still the one last read or written. The file is always replaced
+// by a rename, so a new write is a different file even when it has the same modification time.
+// Must be called with fileMutex held
+func (fileTicketStore *FileTicketStore) unchanged(fileInfo os.FileInfo) bool {
+	lastFileInfo := fileTicketStore.fileInfo
+
+	return lastFileInfo != nil &&
+		os.SameFile(lastFileInfo, fileInfo) &&
+		lastFileInfo.Size() == fileInfo.Size() &&
+		lastFileInfo.ModTime().Equal(fileInfo.ModTime())
+}
+
+// NewFileTicketStore returns a new FileTicketStore, loading any tickets already saved at path
+func NewFileTicketStore(path string) (*FileTicketStore, error) {
+	fileTicketStore := &FileTicketStore{
+		MemoryTicketStore: NewMemoryTicketStore(),
+		path:              path,
+	}
+
+	fileTicketStore.fileMutex.Lock()
+	defer fileTicketStore.fileMutex.Unlock()
+
+	if err := fileTicketStore.merge(true); err != nil {
+		return nil, err
+	}
+
+	return fileTicketStore, nil
+}
+
+// StartTicketCleanup periodically removes expired tickets from a TicketStore until the returned function is called
+func StartTicketCleanup(ticketStore TicketStore, interval time.Duration) func() {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case now := <-ticker.C:
+				_, _ = ticketStore.CleanupTickets(now)
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+// lockFile creates path.lock, waiting for other processes holding it, and returns the function removing it.
+// Lock files older than fileLockStaleAge are removed, as writes only hold them for a moment
+func lockFile(path string) (func(), error) {
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(fileLockTimeout)
+
+	for {
+		lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+
+		if err == nil {
+			lock.Close()
+
+			return func() {
+				os.Remove(lockPath)
+			}, nil
+		}
+
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		if lockInfo, err := os.Stat(lockPath); err == nil && time.Since(lockInfo.ModTime()) > fileLockStaleAge {
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.New("[FileTicketStore] Timed out waiting for " + lockPath)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	temporaryFile, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+
+	if err != nil {
+		return err
+	}
+
+	temporaryPath := temporaryFile.Name()
+
+	if _, err := temporaryFile.Write(data); err != nil {
+		temporaryFile.Close()
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	if err := temporaryFile.Sync(); err != nil {
+		temporaryFile.Close()
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	if err := temporaryFile.Close(); err != nil {
+		os.Remove(temporaryPath)
+		return err
+	}
+
+	return os.Rename(temporaryPath, path)
+}
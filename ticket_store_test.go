@@ -0,0 +1,286 @@
+package nexproto
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testIssuedTicket(userPID uint32, sessionKeyByte byte, expiration time.Time) *IssuedTicket {
+	return &IssuedTicket{
+		UserPID:    userPID,
+		ServerPID:  2,
+		SessionKey: bytes.Repeat([]byte{sessionKeyByte}, 16),
+		Expiration: expiration,
+	}
+}
+
+// newSharedFileTicketStores returns two FileTicketStores using the same file, as two processes would
+func newSharedFileTicketStores(t *testing.T) (string, *FileTicketStore, *FileTicketStore) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tickets.json")
+
+	first, err := NewFileTicketStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, err := NewFileTicketStore(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path, first, second
+}
+
+func TestFileTicketStoreSharedFile(t *testing.T) {
+	_, first, second := newSharedFileTicketStores(t)
+	expiration := time.Now().Add(time.Hour)
+
+	firstTicket := testIssuedTicket(1, 0x01, expiration)
+	secondTicket := testIssuedTicket(2, 0x02, expiration)
+	thirdTicket := testIssuedTicket(2, 0x03, expiration)
+
+	if err := first.AddTicket(firstTicket); err != nil {
+		t.Fatal(err)
+	}
+
+	// the second store has never read the first ticket, it must not be lost when the second store writes
+	if err := second.AddTicket(secondTicket); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.AddTicket(thirdTicket); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		ticketStore *FileTicketStore
+		ticket      *IssuedTicket
+	}{
+		{"first sees own ticket", first, firstTicket},
+		{"first sees ticket of second", first, secondTicket},
+		{"second sees ticket of first", second, firstTicket},
+		{"second sees later ticket of first", second, thirdTicket},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ticket, err := test.ticketStore.LookupTicket(test.ticket.SessionKey)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if ticket.UserPID != test.ticket.UserPID || ticket.Revoked {
+				t.Fatalf("unexpected ticket %+v", ticket)
+			}
+		})
+	}
+
+	reopened, err := NewFileTicketStore(first.path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ticket := range []*IssuedTicket{firstTicket, secondTicket, thirdTicket} {
+		if _, err := reopened.LookupTicket(ticket.SessionKey); err != nil {
+			t.Fatalf("ticket of %d missing after reopening: %v", ticket.UserPID, err)
+		}
+	}
+}
+
+func TestFileTicketStoreRevocation(t *testing.T) {
+	_, first, second := newSharedFileTicketStores(t)
+	expiration := time.Now().Add(time.Hour)
+
+	tickets := []*IssuedTicket{
+		testIssuedTicket(1, 0x01, expiration),
+		testIssuedTicket(2, 0x02, expiration),
+		testIssuedTicket(2, 0x03, expiration),
+		testIssuedTicket(3, 0x04, expiration),
+	}
+
+	for _, ticket := range tickets {
+		if err := first.AddTicket(ticket); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := second.RevokeTicket(tickets[0].SessionKey); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := second.RevokeTicketsForPID(2); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first store adding a ticket must not undo the revocations made through the second
+	if err := first.AddTicket(testIssuedTicket(4, 0x05, expiration)); err != nil {
+		t.Fatal(err)
+	}
+
+	wantRevoked := []bool{true, true, true, false}
+
+	for i, ticket := range tickets {
+		for _, ticketStore := range []*FileTicketStore{first, second} {
+			issuedTicket, err := ticketStore.LookupTicket(ticket.SessionKey)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if issuedTicket.Revoked != wantRevoked[i] {
+				t.Fatalf("ticket %d: got revoked %v, want %v", i, issuedTicket.Revoked, wantRevoked[i])
+			}
+		}
+	}
+
+	if err := second.RevokeTicket(bytes.Repeat([]byte{0xFF}, 16)); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("got %v, want ErrTicketNotFound", err)
+	}
+}
+
+func TestFileTicketStoreCleanup(t *testing.T) {
+	path, first, second := newSharedFileTicketStores(t)
+	now := time.Now()
+
+	if err := first.AddTicket(testIssuedTicket(1, 0x01, now.Add(time.Minute))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.AddTicket(testIssuedTicket(2, 0x02, now.Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := second.LookupTicket(bytes.Repeat([]byte{0x01}, 16)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := second.CleanupTickets(now.Add(2 * time.Minute))
+
+	if err != nil || removed != 1 {
+		t.Fatalf("got %d removed: %v", removed, err)
+	}
+
+	if _, err := second.LookupTicket(bytes.Repeat([]byte{0x01}, 16)); !errors.Is(err, ErrTicketNotFound) {
+		t.Fatalf("got %v, want ErrTicketNotFound", err)
+	}
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tickets []*IssuedTicket
+
+	if err := json.Unmarshal(data, &tickets); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tickets) != 1 || tickets[0].UserPID != 2 {
+		t.Fatalf("unexpected tickets in file %+v", tickets)
+	}
+}
+
+func TestFileTicketStoreLockFile(t *testing.T) {
+	path, first, _ := newSharedFileTicketStores(t)
+	lockPath := path + ".lock"
+
+	t.Run("stale lock is removed", func(t *testing.T) {
+		if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		staleTime := time.Now().Add(-2 * fileLockStaleAge)
+
+		if err := os.Chtimes(lockPath, staleTime, staleTime); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := first.AddTicket(testIssuedTicket(1, 0x01, time.Now().Add(time.Hour))); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("lock file left behind: %v", err)
+		}
+	})
+
+	t.Run("held lock blocks writes", func(t *testing.T) {
+		if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error, 1)
+
+		go func() {
+			done <- first.AddTicket(testIssuedTicket(2, 0x02, time.Now().Add(time.Hour)))
+		}()
+
+		select {
+		case err := <-done:
+			t.Fatalf("write finished while the lock was held: %v", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		if err := os.Remove(lockPath); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("write did not finish once the lock was released")
+		}
+	})
+}
+
+func TestStartTicketCleanup(t *testing.T) {
+	ticketStore := NewMemoryTicketStore()
+
+	if err := ticketStore.AddTicket(testIssuedTicket(1, 0x01, time.Now().Add(-time.Second))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ticketStore.AddTicket(testIssuedTicket(2, 0x02, time.Now().Add(time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := StartTicketCleanup(ticketStore, 5*time.Millisecond)
+	defer stop()
+
+	deadline := time.Now().Add(time.Second)
+
+	for {
+		if _, err := ticketStore.LookupTicket(bytes.Repeat([]byte{0x01}, 16)); errors.Is(err, ErrTicketNotFound) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expired ticket was not cleaned up")
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := ticketStore.LookupTicket(bytes.Repeat([]byte{0x02}, 16)); err != nil {
+		t.Fatalf("unexpired ticket was cleaned up: %v", err)
+	}
+
+	// stopping twice must not panic
+	stop()
+}